@@ -0,0 +1,577 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultAgentSocket returns the unix socket -agent listens on and -use-agent
+// connects to unless -agent-socket is given: in $XDG_RUNTIME_DIR when set,
+// otherwise in a per-user directory under the temp dir
+func defaultAgentSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "axion-agent.sock")
+	}
+	return filepath.Join(agentDir(), "agent.sock")
+}
+
+// agentDir is the 0700 directory holding the default socket when there is no
+// $XDG_RUNTIME_DIR
+func agentDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("axion-%d", os.Getuid()))
+}
+
+// agentRequest asks the agent to run a command on a VPS over a pooled
+// connection. It carries the ExecOptions that matter on the agent side
+type agentRequest struct {
+	VPS           VPS
+	Command       string
+	Timeout       time.Duration
+	KnownHosts    string
+	Retries       int
+	RetryDelay    time.Duration
+	HostTimeout   time.Duration
+	Deadline      time.Time
+	BindAddr      string
+	OutDir        string
+	Masks         []string
+	ClientVersion string
+	Gunzip        bool
+	Sudo          bool
+	WarnAfter     time.Duration
+	OnFailure     string
+	KillSignal    string
+	KillGrace     time.Duration
+	Stdin         []byte
+	RemoteTimes   bool
+	Pty           bool
+	Env           []string
+	Keepalive     time.Duration
+}
+
+// agentResult is a Result as sent back by the agent, with errors as strings
+type agentResult struct {
+	Success     bool
+	Skipped     bool
+	Stdout      string
+	Stderr      string
+	Error       string
+	ExitCode    int
+	SudoAuth    bool
+	EnvVia      string
+	Category    string
+	Attempts    []agentAttempt
+	Addr        string
+	Reused      bool
+	Duration    time.Duration
+	Slow        bool
+	RemoteStart time.Time
+	RemoteEnd   time.Time
+	StdoutBytes int64
+	StderrBytes int64
+	Cleanup     *agentResult
+}
+
+type agentAttempt struct {
+	Error    string
+	Duration time.Duration
+}
+
+// newAgentRequest builds the request for running command on vps. Per-host
+// stdin is read and the output directory resolved here, on the caller's side
+func newAgentRequest(vps VPS, command string, opts ExecOptions) (agentRequest, error) {
+	req := agentRequest{
+		VPS:           vps,
+		Command:       command,
+		Timeout:       opts.Timeout,
+		KnownHosts:    opts.KnownHosts,
+		Retries:       opts.Retries,
+		RetryDelay:    opts.RetryDelay,
+		HostTimeout:   opts.HostTimeout,
+		Deadline:      opts.Deadline,
+		ClientVersion: opts.ClientVersion,
+		Gunzip:        opts.Gunzip,
+		Sudo:          opts.Sudo,
+		WarnAfter:     opts.WarnAfter,
+		OnFailure:     opts.OnFailure,
+		KillSignal:    string(opts.KillSignal),
+		KillGrace:     opts.KillGrace,
+		RemoteTimes:   opts.RemoteTimes,
+		Pty:           opts.Pty,
+		Env:           opts.Env,
+		Keepalive:     opts.Keepalive,
+	}
+	if opts.BindAddr != nil {
+		req.BindAddr = opts.BindAddr.String()
+	}
+	for _, re := range opts.Masks {
+		req.Masks = append(req.Masks, re.String())
+	}
+
+	if opts.OutDir != "" {
+		dir, err := filepath.Abs(opts.OutDir)
+		if err != nil {
+			return req, fmt.Errorf("failed to resolve output directory: %v", err)
+		}
+		req.OutDir = dir
+	}
+
+	stdin, err := hostStdin(vps, opts)
+	if err != nil {
+		return req, err
+	}
+	if stdin != nil {
+		if req.Stdin, err = io.ReadAll(stdin); err != nil {
+			return req, fmt.Errorf("failed to read stdin data: %v", err)
+		}
+	}
+	return req, nil
+}
+
+// execOptions rebuilds the ExecOptions of a request on the agent side
+func (r agentRequest) execOptions() (ExecOptions, error) {
+	opts := ExecOptions{
+		Timeout:       r.Timeout,
+		KnownHosts:    r.KnownHosts,
+		Retries:       r.Retries,
+		RetryDelay:    r.RetryDelay,
+		HostTimeout:   r.HostTimeout,
+		Deadline:      r.Deadline,
+		OutDir:        r.OutDir,
+		ClientVersion: r.ClientVersion,
+		Gunzip:        r.Gunzip,
+		Sudo:          r.Sudo,
+		WarnAfter:     r.WarnAfter,
+		OnFailure:     r.OnFailure,
+		KillSignal:    ssh.Signal(r.KillSignal),
+		KillGrace:     r.KillGrace,
+		Stdin:         r.Stdin,
+		RemoteTimes:   r.RemoteTimes,
+		Pty:           r.Pty,
+		Env:           r.Env,
+		Keepalive:     r.Keepalive,
+	}
+	if r.KnownHosts != "" {
+		callback, err := verifyHostKeys(r.KnownHosts)
+		if err != nil {
+			return opts, err
+		}
+		opts.HostKeyCallback = callback
+	}
+	if r.BindAddr != "" {
+		addr, err := parseBindAddr(r.BindAddr)
+		if err != nil {
+			return opts, err
+		}
+		opts.BindAddr = addr
+	}
+	for _, pattern := range r.Masks {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return opts, fmt.Errorf("invalid mask pattern '%s': %v", pattern, err)
+		}
+		opts.Masks = append(opts.Masks, re)
+	}
+	return opts, nil
+}
+
+// errString returns the message of err, or "" for nil
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// errFromString is the inverse of errString
+func errFromString(s string) error {
+	if s == "" {
+		return nil
+	}
+	return errors.New(s)
+}
+
+func toAgentResult(result Result) agentResult {
+	r := agentResult{
+		Success:     result.Success,
+		Skipped:     result.Skipped,
+		Stdout:      result.Stdout,
+		Stderr:      result.Stderr,
+		Error:       errString(result.Error),
+		ExitCode:    result.ExitCode,
+		SudoAuth:    result.SudoAuthFailed,
+		EnvVia:      result.EnvVia,
+		Category:    result.Category,
+		Addr:        result.Addr,
+		Reused:      result.Reused,
+		Duration:    result.Duration,
+		Slow:        result.Slow,
+		RemoteStart: result.RemoteStart,
+		RemoteEnd:   result.RemoteEnd,
+		StdoutBytes: result.StdoutBytes,
+		StderrBytes: result.StderrBytes,
+	}
+	for _, attempt := range result.Attempts {
+		r.Attempts = append(r.Attempts, agentAttempt{Error: errString(attempt.Error), Duration: attempt.Duration})
+	}
+	if result.Cleanup != nil {
+		cleanup := toAgentResult(*result.Cleanup)
+		r.Cleanup = &cleanup
+	}
+	return r
+}
+
+// result converts the agent's answer back into the Result for vps
+func (r agentResult) result(vps VPS) Result {
+	result := Result{
+		VPS:            vps,
+		Success:        r.Success,
+		Skipped:        r.Skipped,
+		Stdout:         r.Stdout,
+		Stderr:         r.Stderr,
+		Error:          errFromString(r.Error),
+		ExitCode:       r.ExitCode,
+		SudoAuthFailed: r.SudoAuth,
+		EnvVia:         r.EnvVia,
+		Category:       r.Category,
+		Addr:           r.Addr,
+		Reused:         r.Reused,
+		Duration:       r.Duration,
+		Slow:           r.Slow,
+		RemoteStart:    r.RemoteStart,
+		RemoteEnd:      r.RemoteEnd,
+		StdoutBytes:    r.StdoutBytes,
+		StderrBytes:    r.StderrBytes,
+	}
+	for _, attempt := range r.Attempts {
+		result.Attempts = append(result.Attempts, Attempt{Error: errFromString(attempt.Error), Duration: attempt.Duration})
+	}
+	if r.Cleanup != nil {
+		cleanup := r.Cleanup.result(vps)
+		result.Cleanup = &cleanup
+	}
+	return result
+}
+
+// agentTask returns a hostTask that runs command through the agent listening
+// on socket, connecting directly when no agent is running
+func agentTask(socket, command string, opts ExecOptions) hostTask {
+	direct := commandTask(command, opts)
+	var warnOnce sync.Once
+
+	return func(ctx context.Context, vps VPS) Result {
+		if err := checkAgentSocket(socket); err != nil && !os.IsNotExist(err) {
+			warnOnce.Do(func() {
+				fmt.Fprintf(os.Stderr, "Warning: not using agent socket, connecting directly: %v\n", err)
+			})
+			return direct(ctx, vps)
+		}
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "unix", socket)
+		if err != nil {
+			if ctx.Err() != nil {
+				return skipResult(Result{VPS: vps, ExitCode: -1}, ctx.Err())
+			}
+			warnOnce.Do(func() {
+				fmt.Fprintf(os.Stderr, "Warning: no axion agent on %s, connecting directly: %v\n", socket, err)
+			})
+			return direct(ctx, vps)
+		}
+		defer conn.Close()
+
+		return runViaAgent(ctx, conn, vps, command, opts)
+	}
+}
+
+// runViaAgent sends one request over conn and waits for its result. Hanging
+// up when ctx is done makes the agent stop the command
+func runViaAgent(ctx context.Context, conn net.Conn, vps VPS, command string, opts ExecOptions) Result {
+	result := Result{
+		VPS:      vps,
+		ExitCode: -1,
+	}
+
+	req, err := newAgentRequest(vps, command, opts)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		if ctx.Err() != nil {
+			return skipResult(result, ctx.Err())
+		}
+		result.Error = fmt.Errorf("failed to send request to agent: %v", err)
+		return result
+	}
+
+	var resp agentResult
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			return skipResult(result, ctx.Err())
+		}
+		result.Error = fmt.Errorf("failed to read result from agent: %v", err)
+		return result
+	}
+	return resp.result(vps)
+}
+
+// pooledClient is a warm SSH connection kept by the agent
+type pooledClient struct {
+	mu       sync.Mutex
+	client   *ssh.Client // nil when not connected
+	addr     string
+	lastUsed time.Time
+	active   int // Requests currently using the client, never reaped while > 0
+}
+
+// agent keeps authenticated SSH clients warm between axion invocations
+type agent struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	pool map[string]*pooledClient
+}
+
+// poolKey identifies connections that can be shared: same credentials, same
+// addresses and same connection settings
+func poolKey(vps VPS, opts ExecOptions) string {
+	bind := ""
+	if opts.BindAddr != nil {
+		bind = opts.BindAddr.String()
+	}
+	// The connect timeout only matters for new connections (and changes
+	// from run to run under -latency-aware)
+	options := maps.Clone(vps.Options)
+	delete(options, "connect_timeout")
+	return strings.Join([]string{
+		vps.Username,
+		vps.Password,
+		strings.Join(sshAddrs(vps), ","),
+		fmt.Sprint(options), // Maps print in sorted key order
+		opts.ClientVersion,
+		opts.KnownHosts, // Pooled connections were verified against this file
+		bind,
+	}, "\x00")
+}
+
+// clientAlive reports whether a pooled client still answers requests, closing
+// it if it doesn't reply in time
+func clientAlive(client *ssh.Client) bool {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err == nil
+	case <-time.After(5 * time.Second):
+		client.Close()
+		return false
+	}
+}
+
+// acquire returns a connected client for vps, reusing a warm one when it is
+// still alive. Call release with the returned entry when done
+func (a *agent) acquire(ctx context.Context, vps VPS, opts ExecOptions, result *Result) (*pooledClient, *ssh.Client, error) {
+	key := poolKey(vps, opts)
+	a.mu.Lock()
+	entry, ok := a.pool[key]
+	if !ok {
+		entry = &pooledClient{}
+		a.pool[key] = entry
+	}
+	a.mu.Unlock()
+
+	// Concurrent requests for the same host wait for a single connection
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.client != nil && clientAlive(entry.client) {
+		result.Addr = entry.addr
+		result.Reused = true
+	} else {
+		if entry.client != nil {
+			entry.client.Close()
+			entry.client = nil
+		}
+		client, err := connectAttempt(ctx, vps, opts, result)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.client, entry.addr = client, result.Addr
+	}
+
+	entry.active++
+	return entry, entry.client, nil
+}
+
+// release returns a client acquired with acquire to the pool
+func (a *agent) release(entry *pooledClient) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.active--
+	entry.lastUsed = time.Now()
+}
+
+// reap closes clients that have been idle for longer than the TTL
+func (a *agent) reap() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, entry := range a.pool {
+		if !entry.mu.TryLock() {
+			continue // Busy connecting, not idle
+		}
+		if entry.active == 0 && time.Since(entry.lastUsed) > a.ttl {
+			if entry.client != nil {
+				entry.client.Close()
+			}
+			delete(a.pool, key)
+		}
+		entry.mu.Unlock()
+	}
+}
+
+// closeAll closes every pooled client
+func (a *agent) closeAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, entry := range a.pool {
+		entry.mu.Lock()
+		if entry.client != nil {
+			entry.client.Close()
+		}
+		entry.mu.Unlock()
+		delete(a.pool, key)
+	}
+}
+
+// serve handles a single request on conn
+func (a *agent) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var req agentRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	result := Result{
+		VPS:      req.VPS,
+		ExitCode: -1,
+	}
+
+	opts, err := req.execOptions()
+	if err != nil {
+		result.Error = err
+		json.NewEncoder(conn).Encode(toAgentResult(result))
+		return
+	}
+
+	ctx, cancel := hostContext(context.Background(), opts)
+	defer cancel()
+
+	// The caller hanging up (interrupted, -host-timeout) stops the command
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	entry, client, err := a.acquire(ctx, req.VPS, opts, &result)
+	if err != nil {
+		if ctx.Err() != nil {
+			result = skipResult(result, ctx.Err())
+		} else {
+			result.Error = connectError(err)
+		}
+		json.NewEncoder(conn).Encode(toAgentResult(result))
+		return
+	}
+	defer a.release(entry)
+
+	result = executeOnClient(ctx, client, result, req.Command, opts)
+	json.NewEncoder(conn).Encode(toAgentResult(result))
+}
+
+// runAgent listens on socket and serves requests until interrupted, closing
+// connections left idle for longer than ttl
+func runAgent(socket string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid -agent-ttl %s: must be positive", ttl)
+	}
+
+	if filepath.Dir(socket) == agentDir() {
+		if err := makePrivateDir(agentDir()); err != nil {
+			return err
+		}
+	}
+
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("an agent is already listening on %s", socket)
+	}
+	// Stale socket left by an agent that didn't shut down cleanly. Anything
+	// that isn't a socket is left alone
+	if info, err := os.Lstat(socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s already exists and is not a socket", socket)
+		}
+		os.Remove(socket)
+	}
+
+	// Requests carry VPS passwords, the socket is private to this user
+	listener, err := listenPrivate(socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", socket, err)
+	}
+	defer listener.Close()
+
+	a := &agent{ttl: ttl, pool: make(map[string]*pooledClient)}
+	defer a.closeAll()
+
+	interval := max(ttl/2, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	go func() {
+		for range ticker.C {
+			a.reap()
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "axion agent listening on %s (idle TTL %s)\n", socket, ttl)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			continue
+		}
+		go a.serve(conn)
+	}
+}
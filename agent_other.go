@@ -0,0 +1,35 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// checkAgentSocket makes sure socket is a unix socket. File ownership can't
+// be checked on this platform
+func checkAgentSocket(socket string) error {
+	info, err := os.Lstat(socket)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a socket", socket)
+	}
+	return nil
+}
+
+// makePrivateDir creates dir with mode 0700 if it doesn't exist
+func makePrivateDir(dir string) error {
+	if err := os.Mkdir(dir, 0o700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	return nil
+}
+
+// listenPrivate listens on socket, this platform has no umask
+func listenPrivate(socket string) (net.Listener, error) {
+	return net.Listen("unix", socket)
+}
@@ -0,0 +1,56 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkAgentSocket makes sure socket is a unix socket owned by this user, so
+// requests carrying VPS passwords never go to a socket someone else created
+func checkAgentSocket(socket string) error {
+	info, err := os.Lstat(socket)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a socket", socket)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by uid %d, not by you", socket, st.Uid)
+	}
+	return nil
+}
+
+// makePrivateDir creates dir with mode 0700, or checks that an existing dir
+// belongs to this user and is closed to everyone else
+func makePrivateDir(dir string) error {
+	if err := os.Mkdir(dir, 0o700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by uid %d, not by you", dir, st.Uid)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s is accessible to other users (mode %s)", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// listenPrivate listens on socket with a umask that leaves it private to
+// this user from the moment it is created
+func listenPrivate(socket string) (net.Listener, error) {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", socket)
+}
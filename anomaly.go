@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// anomalyKey is what -anomaly compares between hosts: whether the command
+// succeeded and its output, ignoring trailing whitespace
+type anomalyKey struct {
+	Success bool
+	Stdout  string
+}
+
+func anomalyKeyOf(result Result) anomalyKey {
+	return anomalyKey{Success: result.Success, Stdout: strings.TrimRight(result.Stdout, " \t\r\n")}
+}
+
+// findAnomalies picks the most common outcome as the baseline (ties go to the
+// one seen first in target order) and returns it with the number of hosts
+// sharing it and the results that differ from it
+func findAnomalies(results []Result) (anomalyKey, int, []Result) {
+	counts := make(map[anomalyKey]int)
+	for _, result := range results {
+		counts[anomalyKeyOf(result)]++
+	}
+
+	var baseline anomalyKey
+	best := 0
+	for _, result := range results {
+		if key := anomalyKeyOf(result); counts[key] > best {
+			baseline, best = key, counts[key]
+		}
+	}
+
+	var anomalies []Result
+	for _, result := range results {
+		if anomalyKeyOf(result) != baseline {
+			anomalies = append(anomalies, result)
+		}
+	}
+	return baseline, best, anomalies
+}
+
+// writeAnomalies prints the majority output once and then only the hosts
+// whose outcome differs from it
+func writeAnomalies(w io.Writer, results []Result, color bool) {
+	baseline, count, anomalies := findAnomalies(results)
+
+	fmt.Fprintf(w, "=== baseline: %d of %d hosts ===\n", count, len(results))
+	if !baseline.Success {
+		fmt.Fprintln(w, "(failed)")
+	}
+	if baseline.Stdout != "" {
+		fmt.Fprintln(w, baseline.Stdout)
+	}
+	fmt.Fprintln(w)
+
+	if len(anomalies) == 0 {
+		fmt.Fprintln(w, "No anomalies: every host matches the baseline")
+		return
+	}
+
+	fmt.Fprintf(w, "=== anomalies: %d host(s) ===\n\n", len(anomalies))
+	for _, result := range anomalies {
+		writeResult(w, result, color)
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Attempt records one connection attempt to a VPS
+type Attempt struct {
+	Error    error // nil when the attempt connected
+	Duration time.Duration
+}
+
+// connectAttempt connects to the VPS and records every attempt in
+// result.Attempts. Transient failures are retried up to opts.Retries times,
+// waiting opts.RetryDelay before the first retry and doubling it after each
+func connectAttempt(ctx context.Context, vps VPS, opts ExecOptions, result *Result) (*ssh.Client, error) {
+	delay := opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		client, addr, err := connect(ctx, vps, opts)
+		if addr != "" {
+			result.Addr = addr
+		}
+		result.Attempts = append(result.Attempts, Attempt{Error: err, Duration: time.Since(start)})
+		if err == nil || attempt >= opts.Retries || !retryableConnectError(err) {
+			if err != nil && ctx.Err() == nil {
+				result.Category = connectCategory(err)
+			}
+			return client, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retryableConnectError reports whether a connection failure may go away on
+// its own (refused, reset, timed out while a host reboots). Host key and
+// authentication failures won't, and neither will a cancelled run
+func retryableConnectError(err error) bool {
+	var keyErr *hostKeyError
+	if errors.As(err, &keyErr) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return !strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// connectFailed reports whether a host never got a working connection
+// (unreachable, refused, auth failure), as opposed to a command failing
+func connectFailed(result Result) bool {
+	if result.Skipped || len(result.Attempts) == 0 {
+		return false
+	}
+	return result.Attempts[len(result.Attempts)-1].Error != nil
+}
+
+// writeConnectAbort explains a run cut short by -fail-fast-connect, naming
+// the hosts that couldn't be connected to
+func writeConnectAbort(w io.Writer, results []Result) {
+	var failed []string
+	skipped := 0
+	for _, result := range results {
+		if connectFailed(result) {
+			failed = append(failed, result.VPS.Name)
+		} else if result.Skipped {
+			skipped++
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Error: run aborted, failed to connect to %s; %d host(s) skipped\n", strings.Join(failed, ", "), skipped)
+}
+
+// writeRetryReport writes the connection attempt history of every host
+func writeRetryReport(w io.Writer, results []Result) {
+	fmt.Fprintln(w, "Connection attempts:")
+	for _, result := range results {
+		noun := "attempts"
+		if len(result.Attempts) == 1 {
+			noun = "attempt"
+		}
+		if result.Reused {
+			fmt.Fprintf(w, "  [%s] reused agent connection to %s\n", result.VPS.Name, result.Addr)
+			continue
+		}
+		timeout := ""
+		if t, ok := result.VPS.Options["connect_timeout"]; ok {
+			timeout = ", connect timeout " + t
+		}
+		fmt.Fprintf(w, "  [%s] %d %s%s\n", result.VPS.Name, len(result.Attempts), noun, timeout)
+		for i, attempt := range result.Attempts {
+			if attempt.Error != nil {
+				fmt.Fprintf(w, "    #%d failed after %s: %v\n", i+1, attempt.Duration.Round(time.Millisecond), attempt.Error)
+			} else {
+				fmt.Fprintf(w, "    #%d connected to %s in %s\n", i+1, result.Addr, attempt.Duration.Round(time.Millisecond))
+			}
+		}
+	}
+}
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/kevinburke/ssh_config"
 	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v3"
 
@@ -18,62 +32,273 @@ import (
 
 // VPS represents a VPS configuration entry
 type VPS struct {
-	Name     string `yaml:"name"`
-	IP       string `yaml:"ip"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Secret   string `yaml:"secret"` // Placeholder for future SSH key support
+	Name     string            `yaml:"name"`
+	IP       string            `yaml:"ip"`
+	IPs      []string          `yaml:"ips"`  // Extra addresses (e.g., IPv6) raced against IP, first to connect wins
+	Port     int               `yaml:"port"` // SSH port, default 22 (or the port given in ip)
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Secret   string            `yaml:"secret"`    // Private key file path or PEM content, used instead of the password
+	SudoUser string            `yaml:"sudo_user"` // Target user for -sudo on this host (default root)
+	Tags     []string          `yaml:"tags"`      // Free-form labels, "key=value" tags can be used with -group-results-by
+	Options  map[string]string `yaml:"options"`   // Per-host SSH client settings, see hostOptionKeys
+	Priority int               `yaml:"priority"`  // Higher priority hosts run (and print) first
+
+	selector string // Selector that matched this entry, set during target resolution
 }
 
 // Result represents the execution result for a VPS
 type Result struct {
-	VPS     VPS
-	Success bool
-	Stdout  string
-	Stderr  string
-	Error   error
+	VPS      VPS
+	Success  bool
+	Skipped  bool // Host was abandoned after -host-timeout, not counted as a failure
+	Stdout   string
+	Stderr   string
+	Error    error
+	ExitCode int           // Remote exit status, -1 when the command never reported one
+	Uptime   *UptimeInfo   // Parsed uptime/load, only set in -uptime mode
+	Version  string        // Reported version, only set in -version-check mode
+	Facts    *Facts        // Parsed system facts, only set in -facts mode
+	Attempts []Attempt     // Connection attempt history, oldest first
+	Addr     string        // Address the SSH connection was made to
+	Reused   bool          // Connection was a warm one from the -use-agent pool
+	Duration time.Duration // How long the remote command ran
+	Slow     bool          // Command ran longer than -warn-after
+
+	SudoAuthFailed bool   // -sudo rejected the password, so the command itself never ran
+	EnvVia         string // How -env reached the command: "setenv" or "export" (empty without -env)
+	FailedCommand  int    // 1-based position of the repeated -c command that failed (0 = none)
+	Category       string // Why the connection failed (e.g., "refused", "timeout"), empty once connected
+
+	MatchedBy string // Selector that put the host in the target list (e.g., "-l 1-20 (number 5)")
+
+	StdoutBytes int64 // Bytes of stdout received, before -gunzip
+	StderrBytes int64 // Bytes of stderr received
+
+	RemoteStart time.Time // Remote clock when the command started, only set with -remote-times
+	RemoteEnd   time.Time // Remote clock when the command finished, only set with -remote-times
+
+	TransformError error   // -transform failed, Stdout is the untransformed output
+	Cleanup        *Result // Result of the -on-failure command, if it ran
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// ExecOptions controls how commands are executed on each VPS
+type ExecOptions struct {
+	HostTimeout     time.Duration       // Abandon a single host once it runs longer than this (0 = no limit)
+	Timeout         time.Duration       // Connect timeout, and limit after which a command fails as timed out (0 = none)
+	KnownHosts      string              // known_hosts file host keys are verified against (empty = accept any host key)
+	HostKeyCallback ssh.HostKeyCallback // Verifies host keys, loaded from KnownHosts (nil = accept any host key)
+	Retries         int                 // Extra connection attempts after a transient connect failure
+	RetryDelay      time.Duration       // Wait before the first retry, doubled after each one
+	BindAddr        *net.TCPAddr        // Local source address for outbound connections (nil = system default)
+	OutDir          string              // Also write each host's stdout/stderr to files in this directory
+	Masks           []*regexp.Regexp    // Replace matches with "***" in all captured output
+	ClientVersion   string              // Custom SSH identification string (empty = library default)
+	Gunzip          bool                // Decompress gzip stdout before capturing it
+	Sudo            bool                // Run commands through sudo, feeding the VPS password on stdin
+	WarnAfter       time.Duration       // Flag commands running longer than this as slow without failing them
+	Transform       string              // Local shell command each host's stdout is piped through
+	OnFailure       string              // Command run on the same connection when the main command exits non-zero
+	Parallel        int                 // Maximum hosts worked on at once (0 = all at once)
+	KillSignal      ssh.Signal          // Signal sent to a command that is stopped early (empty = just close the session)
+	KillGrace       time.Duration       // How long a signalled command may take to exit before the session is closed
+	Stdin           []byte              // Data piped to every host's command
+	Deadline        time.Time           // Abandon every host still running at this time (zero = none)
+	StdinDir        string              // Directory of per-host data files (<dir>/<name>) piped to each command
+	RemoteTimes     bool                // Command was wrapped with withRemoteTimes, parse its timestamps from stderr
+	Keepalive       time.Duration       // Interval of keepalive requests on each connection, unless the host sets its own (0 = none)
+	Env             []string            // KEY=VALUE variables for the command, via Setenv or exported in the command
+	Jump            *jumpHost           // Bastion every connection is tunnelled through (nil = connect directly)
+	Pty             bool                // Run the command in a pseudo-terminal (stderr is merged into stdout)
+	Stream          *streamPrinter      // Prints each output line with the VPS name as it arrives (nil = buffer only)
+	FailFastConnect bool                // Skip every unfinished host as soon as one fails to connect or authenticate
+	Executor        Executor            // Runs each command (nil = SSHExecutor with these options)
+	Progress        *progressMeter      // Shows how many hosts have finished on stderr (nil = no progress line)
+
+	// Context, if set, bounds the whole batch: once it is done (e.g., on
+	// Ctrl-C) running commands are stopped and unfinished hosts are skipped
+	Context context.Context
+
+	// OnResult, if set, is called as each host completes with the host's
+	// position in the target list. Calls are serialized
+	OnResult func(i int, result Result)
 }
 
 const configPath = "/root/.config/axion/config.yaml"
 
+// Size of the terminal requested with -pty
+const (
+	ptyWidth  = 80
+	ptyHeight = 24
+)
+
+// defaultConfigPath returns the config used without -config:
+// $XDG_CONFIG_HOME/axion/config.yaml (or ~/.config/axion/config.yaml) when it
+// exists, otherwise configPath
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		path := filepath.Join(dir, "axion", "config.yaml")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return configPath
+}
+
+// exitCodeConnFailure is the process exit code reserved for hosts that never
+// reported a remote exit status (connection, auth or session failures)
+const exitCodeConnFailure = 255
+
+// exitCodeInterrupted is the process exit code after Ctrl-C or SIGTERM
+const exitCodeInterrupted = 130
+
 // ConfigFile represents the config file structure (supports both formats)
 type ConfigFile struct {
-	Credentials []VPS `yaml:"credentials"`
+	Defaults    ConfigDefaults `yaml:"defaults"`
+	Credentials []VPS          `yaml:"credentials"`
 }
 
-// loadConfig reads and parses the YAML configuration file
-func loadConfig(path string) ([]VPS, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("config file not found at %s", path)
+// ConfigDefaults fills in the login of credentials entries that leave it blank
+type ConfigDefaults struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Port     int    `yaml:"port"`
+}
+
+// applyDefaults fills blank fields of vps from defaults. The password is only
+// used for entries with neither a password nor a secret, and the port only
+// when the ip doesn't carry one
+func applyDefaults(vps *VPS, defaults ConfigDefaults) {
+	if vps.Username == "" {
+		vps.Username = defaults.Username
+	}
+	if vps.Password == "" && vps.Secret == "" {
+		vps.Password = defaults.Password
+	}
+	if vps.Port == 0 {
+		if _, _, err := net.SplitHostPort(vps.IP); err != nil {
+			vps.Port = defaults.Port
+		}
+	}
+}
+
+// loadConfig reads and parses the YAML configuration from a file or an
+// HTTP(S) URL, sending headers with URL requests. Fields an entry leaves
+// blank are looked up in sshConfig (nil = none) by the entry's name
+func loadConfig(path string, headers http.Header, sshConfig *ssh_config.Config) ([]VPS, error) {
+	vpsList, _, err := loadConfigWithDefaults(path, headers, sshConfig)
+	return vpsList, err
+}
+
+// loadConfigWithDefaults is loadConfig, also returning the config's defaults
+// (only set in the credentials format)
+func loadConfigWithDefaults(path string, headers http.Header, sshConfig *ssh_config.Config) ([]VPS, ConfigDefaults, error) {
+	var data []byte
+	var err error
+	if isConfigURL(path) {
+		data, err = fetchConfig(path, headers)
+		if err != nil {
+			return nil, ConfigDefaults{}, err
+		}
+	} else {
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, ConfigDefaults{}, fmt.Errorf("config file not found at %s", path)
+		}
 	}
 
 	var vpsList []VPS
+	var defaults ConfigDefaults
 
 	// Try parsing as simple list first
 	if err := yaml.Unmarshal(data, &vpsList); err != nil {
-		// If that fails, try parsing with credentials wrapper
-		var configFile ConfigFile
-		if err2 := yaml.Unmarshal(data, &configFile); err2 != nil {
-			return nil, fmt.Errorf("failed to parse config: %v (also tried credentials format: %v)", err, err2)
+		// Then as a map keyed by name, then with the credentials wrapper
+		named, ok, err3 := parseNamedConfig(data)
+		if err3 != nil {
+			return nil, ConfigDefaults{}, err3
+		}
+		if ok {
+			vpsList = named
+		} else {
+			var configFile ConfigFile
+			if err2 := yaml.Unmarshal(data, &configFile); err2 != nil {
+				return nil, ConfigDefaults{}, fmt.Errorf("failed to parse config: %v (also tried credentials format: %v)", err, err2)
+			}
+			vpsList = configFile.Credentials
+			defaults = configFile.Defaults
 		}
-		vpsList = configFile.Credentials
 	}
 
-	// Validate entries
-	for i, vps := range vpsList {
-		if vps.IP == "" {
-			return nil, fmt.Errorf("VPS entry %d: IP is required", i+1)
-		}
-		if vps.Username == "" {
-			return nil, fmt.Errorf("VPS entry %d: username is required", i+1)
+	if isConfigURL(path) {
+		if err := checkRemotePasswords(vpsList, defaults); err != nil {
+			return nil, ConfigDefaults{}, err
 		}
-		if vps.Password == "" {
-			return nil, fmt.Errorf("VPS entry %d: password is required", i+1)
+	}
+
+	// Validate entries
+	for i := range vpsList {
+		if err := prepareEntry(&vpsList[i], defaults, sshConfig); err != nil {
+			return nil, ConfigDefaults{}, fmt.Errorf("VPS entry %d: %v", i+1, err)
 		}
 	}
 
-	return vpsList, nil
+	return vpsList, defaults, nil
+}
+
+// prepareEntry fills in the blanks of a config entry, from the ssh config
+// first and then from the defaults, and checks it has everything needed to
+// connect
+func prepareEntry(vps *VPS, defaults ConfigDefaults, sshConfig *ssh_config.Config) error {
+	if err := applySSHConfig(vps, sshConfig); err != nil {
+		return err
+	}
+
+	// The first of "ips" is the primary address when "ip" is omitted
+	if vps.IP == "" && len(vps.IPs) > 0 {
+		vps.IP = vps.IPs[0]
+	}
+
+	if vps.IP == "" {
+		return fmt.Errorf("IP is required")
+	}
+	applyDefaults(vps, defaults)
+	var err error
+	if vps.Password, err = resolvePassword(vps.Password); err != nil {
+		return err
+	}
+	if err := normalizePort(vps); err != nil {
+		return err
+	}
+	if vps.Username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if vps.Password == "" && vps.Secret == "" {
+		return fmt.Errorf("password or secret is required")
+	}
+	if vps.Secret != "" {
+		if _, _, err := parseSecretKey(*vps); err != nil {
+			return err
+		}
+	}
+	return validateHostOptions(vps.Options)
 }
 
 // extractNumberFromName extracts the numeric part from a VPS name (e.g., "worker60" -> 60)
@@ -91,6 +316,20 @@ func extractNumberFromName(name string) (int, error) {
 	return num, nil
 }
 
+// errNoNumberedNames is returned by number-based selection when no entry in
+// the config has a trailing number in its name, so nothing could ever match
+var errNoNumberedNames = errors.New("no VPS name in the config ends with a number; -i/-l/-lowest/-highest select by that number, use -n to select by name or -pos by position instead")
+
+// hasNumberedNames reports whether any VPS name ends with a number
+func hasNumberedNames(vpsList []VPS) bool {
+	for i := range vpsList {
+		if _, err := extractNumberFromName(vpsList[i].Name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // findVPSByNumber finds a VPS by the number in its name
 func findVPSByNumber(vpsList []VPS, number int) (*VPS, error) {
 	for i := range vpsList {
@@ -102,11 +341,67 @@ func findVPSByNumber(vpsList []VPS, number int) (*VPS, error) {
 			return &vpsList[i], nil
 		}
 	}
+	if !hasNumberedNames(vpsList) {
+		return nil, errNoNumberedNames
+	}
 	return nil, fmt.Errorf("VPS with number %d not found", number)
 }
 
-// findVPSInRange finds all VPS entries whose numbers fall within the given range
+// duplicateNumbers returns, for every number shared by more than one VPS
+// name, the colliding names in config order. Number-based selection only
+// ever picks the first of them
+func duplicateNumbers(vpsList []VPS) map[int][]string {
+	byNumber := make(map[int][]string)
+	for i := range vpsList {
+		if num, err := extractNumberFromName(vpsList[i].Name); err == nil {
+			byNumber[num] = append(byNumber[num], vpsList[i].Name)
+		}
+	}
+	for num, names := range byNumber {
+		if len(names) < 2 {
+			delete(byNumber, num)
+		}
+	}
+	return byNumber
+}
+
+// warnDuplicateNumbers prints a warning for -i for each number shared by several
+// VPS names, in ascending order of number
+func warnDuplicateNumbers(w io.Writer, vpsList []VPS) {
+	dups := duplicateNumbers(vpsList)
+	nums := make([]int, 0, len(dups))
+	for num := range dups {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		fmt.Fprintf(w, "Warning: number %d is shared by %s; -i only selects %s\n",
+			num, strings.Join(dups[num], ", "), dups[num][0])
+	}
+}
+
+// openRangeEnd marks an open-ended range ("1-") that runs up to the highest
+// numbered VPS in the config
+const openRangeEnd = -1
+
+// maxVPSNumber returns the highest number found in VPS names (0 if none)
+func maxVPSNumber(vpsList []VPS) int {
+	highest := 0
+	for i := range vpsList {
+		if num, err := extractNumberFromName(vpsList[i].Name); err == nil && num > highest {
+			highest = num
+		}
+	}
+	return highest
+}
+
+// findVPSInRange finds all VPS entries whose numbers fall within the given range.
+// An end of openRangeEnd extends the range to the highest numbered VPS
 func findVPSInRange(vpsList []VPS, start, end int) ([]VPS, error) {
+	if end == openRangeEnd {
+		end = maxVPSNumber(vpsList)
+	}
+
 	var matched []VPS
 	for i := range vpsList {
 		num, err := extractNumberFromName(vpsList[i].Name)
@@ -118,11 +413,37 @@ func findVPSInRange(vpsList []VPS, start, end int) ([]VPS, error) {
 		}
 	}
 	if len(matched) == 0 {
+		if !hasNumberedNames(vpsList) {
+			return nil, errNoNumberedNames
+		}
 		return nil, fmt.Errorf("no VPS entries found in range %d-%d", start, end)
 	}
 	return matched, nil
 }
 
+// missingNumbers returns the numbers from start to end (up to the highest
+// numbered VPS for an open range) that no VPS name has, except those in skip
+func missingNumbers(vpsList []VPS, start, end int, skip numberRanges) []int {
+	if end == openRangeEnd {
+		end = maxVPSNumber(vpsList)
+	}
+
+	present := make(map[int]bool)
+	for i := range vpsList {
+		if num, err := extractNumberFromName(vpsList[i].Name); err == nil {
+			present[num] = true
+		}
+	}
+
+	var missing []int
+	for num := start; num <= end; num++ {
+		if !present[num] && !skip.contains(num) {
+			missing = append(missing, num)
+		}
+	}
+	return missing
+}
+
 // parseCommaSeparatedIndices parses a comma-separated list of indices (e.g., "52,42,53")
 func parseCommaSeparatedIndices(indicesStr string) ([]int, error) {
 	parts := strings.Split(indicesStr, ",")
@@ -161,6 +482,10 @@ func findVPSByIndices(vpsList []VPS, indices []int) ([]VPS, error) {
 		matched = append(matched, *vps)
 	}
 
+	if len(matched) == 0 && !hasNumberedNames(vpsList) {
+		return nil, errNoNumberedNames
+	}
+
 	if len(notFound) > 0 {
 		return matched, fmt.Errorf("VPS numbers not found: %v", notFound)
 	}
@@ -168,11 +493,226 @@ func findVPSByIndices(vpsList []VPS, indices []int) ([]VPS, error) {
 	return matched, nil
 }
 
-// parseRange parses a range string like "1-20" into start and end indices
+// findVPSByNames finds multiple VPS entries by their exact names
+func findVPSByNames(vpsList []VPS, names []string) ([]VPS, error) {
+	var matched []VPS
+	var notFound []string
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for i := range vpsList {
+			if vpsList[i].Name == name {
+				matched = append(matched, vpsList[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			notFound = append(notFound, name)
+		}
+	}
+
+	if len(notFound) > 0 {
+		return matched, fmt.Errorf("VPS names not found: %v", notFound)
+	}
+
+	return matched, nil
+}
+
+// selectByNumberRank sorts the numbered VPS entries by the number in their
+// name and keeps the n lowest (or highest) ones, in ascending order
+func selectByNumberRank(vpsList []VPS, n int, highest bool) ([]VPS, error) {
+	type numbered struct {
+		num int
+		vps VPS
+	}
+
+	var candidates []numbered
+	for i := range vpsList {
+		num, err := extractNumberFromName(vpsList[i].Name)
+		if err != nil {
+			continue // Skip entries without numbers
+		}
+		candidates = append(candidates, numbered{num, vpsList[i]})
+	}
+	if len(candidates) == 0 {
+		return nil, errNoNumberedNames
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].num < candidates[b].num
+	})
+
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	if highest {
+		candidates = candidates[len(candidates)-n:]
+	} else {
+		candidates = candidates[:n]
+	}
+
+	matched := make([]VPS, len(candidates))
+	for i, c := range candidates {
+		matched[i] = c.vps
+	}
+	return matched, nil
+}
+
+// sortByPriority orders hosts by descending priority, ties by the number in
+// their name (unnumbered names last, in their original order). Targets are left
+// untouched when no host has a priority set
+func sortByPriority(vpsList []VPS) {
+	if !slices.ContainsFunc(vpsList, func(vps VPS) bool { return vps.Priority != 0 }) {
+		return
+	}
+
+	number := func(vps VPS) int {
+		if num, err := extractNumberFromName(vps.Name); err == nil {
+			return num
+		}
+		return math.MaxInt
+	}
+
+	sort.SliceStable(vpsList, func(a, b int) bool {
+		if vpsList[a].Priority != vpsList[b].Priority {
+			return vpsList[a].Priority > vpsList[b].Priority
+		}
+		return number(vpsList[a]) < number(vpsList[b])
+	})
+}
+
+// parseBindAddr parses a local source address given as an IP or IP:port
+// (e.g., "10.0.0.5" or "10.0.0.5:0")
+func parseBindAddr(addr string) (*net.TCPAddr, error) {
+	host, port := addr, "0"
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid bind address '%s': not an IP address", addr)
+	}
+
+	portNum, err := strconv.Atoi(port)
+	if err != nil || portNum < 0 || portNum > 65535 {
+		return nil, fmt.Errorf("invalid bind address '%s': bad port '%s'", addr, port)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: portNum}, nil
+}
+
+// findVPSByPositions finds VPS entries by their 1-based position in the
+// config, regardless of their names
+func findVPSByPositions(vpsList []VPS, positions []int) ([]VPS, error) {
+	var matched []VPS
+	var outOfRange []int
+
+	for _, pos := range positions {
+		if pos > len(vpsList) {
+			outOfRange = append(outOfRange, pos)
+			continue
+		}
+		matched = append(matched, vpsList[pos-1])
+	}
+
+	if len(outOfRange) > 0 {
+		return matched, fmt.Errorf("positions out of range (config has %d entries): %v", len(vpsList), outOfRange)
+	}
+
+	return matched, nil
+}
+
+// numberRange is an inclusive range of VPS numbers, start == end for a
+// single number
+type numberRange struct {
+	start, end int
+}
+
+// numberRanges is a set of VPS numbers kept as ranges, so a wide range costs
+// no more than a single number
+type numberRanges []numberRange
+
+// contains reports whether num is in one of the ranges
+func (r numberRanges) contains(num int) bool {
+	for _, nr := range r {
+		if num >= nr.start && num <= nr.end {
+			return true
+		}
+	}
+	return false
+}
+
+// numbersOf returns nums as single-number ranges
+func numbersOf(nums []int) numberRanges {
+	r := make(numberRanges, len(nums))
+	for i, num := range nums {
+		r[i] = numberRange{num, num}
+	}
+	return r
+}
+
+// excludeNumbers drops the VPS entries whose name number is in excluded
+func excludeNumbers(vpsList []VPS, excluded numberRanges) []VPS {
+	if len(excluded) == 0 {
+		return vpsList
+	}
+
+	var kept []VPS
+	for _, vps := range vpsList {
+		num, err := extractNumberFromName(vps.Name)
+		if err == nil && excluded.contains(num) {
+			continue
+		}
+		kept = append(kept, vps)
+	}
+	return kept
+}
+
+// parseExcludeList parses an -exclude list of numbers and closed ranges
+// like "37,40-42"
+func parseExcludeList(spec string) (numberRanges, error) {
+	var excluded numberRanges
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "-") {
+			nums, err := parseCommaSeparatedIndices(part)
+			if err != nil {
+				return nil, err
+			}
+			excluded = append(excluded, numbersOf(nums)...)
+			continue
+		}
+
+		start, end, err := parseRange(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude range '%s': %v", part, err)
+		}
+		if end == openRangeEnd {
+			return nil, fmt.Errorf("invalid exclude range '%s': end is required", part)
+		}
+		excluded = append(excluded, numberRange{start, end})
+	}
+	if len(excluded) == 0 {
+		return nil, fmt.Errorf("no valid numbers to exclude")
+	}
+	return excluded, nil
+}
+
+// parseRange parses a range string like "1-20" into start and end indices.
+// An open-ended range like "1-" returns end = openRangeEnd
 func parseRange(rangeStr string) (start, end int, err error) {
 	parts := strings.Split(rangeStr, "-")
 	if len(parts) != 2 {
-		return 0, 0, fmt.Errorf("invalid range format: expected 'start-end'")
+		return 0, 0, fmt.Errorf("invalid range format: expected 'start-end' or 'start-'")
 	}
 
 	start, err = strconv.Atoi(strings.TrimSpace(parts[0]))
@@ -180,46 +720,220 @@ func parseRange(rangeStr string) (start, end int, err error) {
 		return 0, 0, fmt.Errorf("invalid start index: %v", err)
 	}
 
-	end, err = strconv.Atoi(strings.TrimSpace(parts[1]))
-	if err != nil {
-		return 0, 0, fmt.Errorf("invalid end index: %v", err)
+	if strings.TrimSpace(parts[1]) == "" {
+		end = openRangeEnd
+	} else {
+		end, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid end index: %v", err)
+		}
 	}
 
 	if start < 1 {
 		return 0, 0, fmt.Errorf("start index must be >= 1")
 	}
 
-	if end < start {
+	if end != openRangeEnd && end < start {
 		return 0, 0, fmt.Errorf("end index must be >= start index")
 	}
 
 	return start, end, nil
 }
 
-// executeCommand connects to a VPS via SSH and executes a command
-func executeCommand(vps VPS, command string) Result {
-	result := Result{
-		VPS: vps,
+// dialSSH opens an SSH client connection to the first of addrs that accepts a
+// TCP connection and returns the address used. The connection is closed if ctx
+// is done before the handshake completes; afterwards callers stop their own work
+func dialSSH(ctx context.Context, addrs []string, config *ssh.ClientConfig, opts ExecOptions) (*ssh.Client, string, error) {
+	dialer := net.Dialer{Timeout: config.Timeout}
+	if opts.BindAddr != nil {
+		dialer.LocalAddr = opts.BindAddr
+	}
+	var conn net.Conn
+	var addr string
+	var err error
+	if opts.Jump != nil {
+		dialCtx, cancel := ctx, context.CancelFunc(func() {})
+		if config.Timeout > 0 {
+			dialCtx, cancel = context.WithTimeout(ctx, config.Timeout)
+		}
+		conn, addr, err = opts.Jump.dialFirst(dialCtx, addrs, opts)
+		cancel()
+	} else {
+		conn, addr, err = dialFirst(ctx, &dialer, addrs)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	// The connect timeout also bounds the SSH handshake and authentication.
+	// Connections tunnelled through -jump don't support deadlines, so they
+	// are closed by a timer instead
+	stopTimer := func() bool { return false }
+	if config.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(config.Timeout)); err != nil {
+			stopTimer = time.AfterFunc(config.Timeout, func() { conn.Close() }).Stop
+		}
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	stop()
+	stopTimer()
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, addr, err
 	}
+	if ctx.Err() != nil {
+		c.Close()
+		return nil, addr, ctx.Err()
+	}
+	return ssh.NewClient(c, chans, reqs), addr, nil
+}
+
+// skipResult marks a result as abandoned because its context was cancelled
+func skipResult(result Result, err error) Result {
+	result.Success = false
+	result.Skipped = true
+	result.Error = fmt.Errorf("skipped: %v", err)
+	return result
+}
 
-	// Build SSH client config
+// newClientConfig builds the SSH client config for a VPS
+func newClientConfig(vps VPS, opts ExecOptions) (*ssh.ClientConfig, error) {
+	auth, err := authMethods(vps)
+	if err != nil {
+		return nil, err
+	}
 	config := &ssh.ClientConfig{
-		User: vps.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(vps.Password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Accept any host key
+		User:            vps.Username,
+		Auth:            auth,
+		HostKeyCallback: opts.HostKeyCallback,
+		ClientVersion:   opts.ClientVersion,
+		Timeout:         opts.Timeout, // A per-host connect_timeout overrides it
+	}
+	if config.HostKeyCallback == nil {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey() // Accept any host key
+	}
+	applyHostOptions(config, vps.Options)
+	return config, nil
+}
+
+// validateClientVersion checks a custom SSH identification string
+// (RFC 4253: "SSH-2.0-softwareversion [comments]", printable ASCII, max 255 chars)
+func validateClientVersion(version string) error {
+	if !strings.HasPrefix(version, "SSH-2.0-") || len(version) == len("SSH-2.0-") {
+		return fmt.Errorf("invalid client version '%s': must start with 'SSH-2.0-' followed by a software version", version)
+	}
+	if len(version) > 253 { // 255 including the trailing CR LF
+		return fmt.Errorf("invalid client version: longer than 253 characters")
+	}
+	for _, r := range version {
+		if r < 0x20 || r > 0x7e {
+			return fmt.Errorf("invalid client version '%s': only printable ASCII is allowed", version)
+		}
+	}
+	return nil
+}
+
+// defaultSSHPort is used for entries without a port
+const defaultSSHPort = 22
+
+// normalizePort moves a port given as part of ip (e.g., "1.2.3.4:2222" or
+// "[2001:db8::1]:2222") into Port, and defaults Port to 22
+func normalizePort(vps *VPS) error {
+	if host, port, err := net.SplitHostPort(vps.IP); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port in ip '%s'", vps.IP)
+		}
+		if vps.Port != 0 && vps.Port != p {
+			return fmt.Errorf("ip '%s' conflicts with port %d", vps.IP, vps.Port)
+		}
+		vps.IP, vps.Port = host, p
+	}
+
+	if vps.Port == 0 {
+		vps.Port = defaultSSHPort
+	}
+	if vps.Port < 1 || vps.Port > 65535 {
+		return fmt.Errorf("invalid port %d", vps.Port)
+	}
+	return nil
+}
+
+// sshPort returns the SSH port of a VPS as a string
+func sshPort(vps VPS) string {
+	if vps.Port == 0 {
+		return strconv.Itoa(defaultSSHPort)
+	}
+	return strconv.Itoa(vps.Port)
+}
+
+// sshAddr returns the host:port address of the VPS SSH server
+func sshAddr(vps VPS) string {
+	return net.JoinHostPort(vps.IP, sshPort(vps))
+}
+
+// connect opens an SSH client connection to a VPS and returns the address used
+func connect(ctx context.Context, vps VPS, opts ExecOptions) (*ssh.Client, string, error) {
+	config, err := newClientConfig(vps, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	client, addr, err := dialSSH(ctx, sshAddrs(vps), config, opts)
+	if err != nil {
+		return nil, addr, err
+	}
+	startKeepalive(client, hostKeepalive(vps, opts))
+	return client, addr, nil
+}
+
+// executeCommand connects to a VPS via SSH and executes a command. Cancelling
+// ctx closes the connection and marks the result as skipped
+func executeCommand(ctx context.Context, vps VPS, command string, opts ExecOptions) Result {
+	result := Result{
+		VPS:      vps,
+		ExitCode: -1,
 	}
 
 	// Connect to SSH server
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:22", vps.IP), config)
+	client, err := connectAttempt(ctx, vps, opts, &result)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to connect: %v", err)
+		if ctx.Err() != nil {
+			return skipResult(result, ctx.Err())
+		}
+		result.Error = connectError(err)
 		result.Success = false
 		return result
 	}
 	defer client.Close()
 
+	return executeOnClient(ctx, client, result, command, opts)
+}
+
+// executeOnClient runs command on a connected client, followed by the
+// -on-failure command on the same connection if the command failed
+func executeOnClient(ctx context.Context, client *ssh.Client, result Result, command string, opts ExecOptions) Result {
+	result = runOnClient(ctx, client, result, command, opts)
+
+	// Compensating action on the same connection when the command itself failed
+	if opts.OnFailure != "" && !result.Success && result.ExitCode > 0 {
+		cleanupOpts := opts
+		cleanupOpts.OutDir = "" // Keep the main command's output files
+		cleanupOpts.Stdin, cleanupOpts.StdinDir = nil, ""
+		cleanupOpts.RemoteTimes = false
+		cleanup := runOnClient(ctx, client, Result{VPS: result.VPS, ExitCode: -1}, opts.OnFailure, cleanupOpts)
+		result.Cleanup = &cleanup
+	}
+	return result
+}
+
+// runOnClient runs command in a new session on an already connected client and
+// fills in result. Each session is its own channel, so a single client can
+// serve several commands sequentially or concurrently
+func runOnClient(ctx context.Context, client *ssh.Client, result Result, command string, opts ExecOptions) Result {
+	vps := result.VPS
+
 	// Create session
 	session, err := client.NewSession()
 	if err != nil {
@@ -244,39 +958,164 @@ func executeCommand(vps VPS, command string) Result {
 		return result
 	}
 
-	// Execute command
-	if err := session.Start(command); err != nil {
+	// Tee output into per-host files alongside the in-memory result
+	var stdoutSink, stderrSink io.Writer = io.Discard, io.Discard
+	if opts.OutDir != "" {
+		stdoutFile, stderrFile, err := createOutputFiles(opts.OutDir, vps)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to create output files: %v", err)
+			result.Success = false
+			return result
+		}
+		defer stdoutFile.Close()
+		defer stderrFile.Close()
+		stdoutSink = newMaskWriter(stdoutFile, opts.Masks)
+		stderrSink = newMaskWriter(stderrFile, opts.Masks)
+	}
+
+	// -stream shows each line live, still keeping it for the result
+	var streamOut, streamErr io.Writer = io.Discard, io.Discard
+	if opts.Stream != nil {
+		streamOut = opts.Stream.writer(os.Stdout, vps, opts.Masks)
+		streamErr = opts.Stream.writer(os.Stderr, vps, opts.Masks)
+	}
+
+	var stdoutBuilder, stderrBuilder strings.Builder
+
+	stdin, err := hostStdin(vps, opts)
+	if err != nil {
+		result.Error = err
+		result.Success = false
+		return result
+	}
+	if stdin != nil {
+		session.Stdin = stdin
+	}
+
+	// Setenv only works for names sshd's AcceptEnv allows, and never survives
+	// sudo; otherwise the variables are exported at the start of the command
+	if len(opts.Env) > 0 {
+		if !opts.Sudo && setSessionEnv(session, opts.Env) {
+			result.EnvVia = envViaSetenv
+		} else {
+			command = withEnv(command, opts.Env)
+			result.EnvVia = envViaExport
+		}
+	}
+
+	// Run through sudo as the host's sudo_user, answering its password
+	// prompt on stdin before any data for the command itself
+	var sudo *sudoFeeder
+	if opts.Sudo {
+		sudo = newSudoFeeder(vps.Password, stdin, io.MultiWriter(&stderrBuilder, stderrSink, streamErr))
+		defer sudo.pr.Close()
+		command = sudo.command(command, vps.SudoUser)
+		session.Stdin = sudo.pr
+	}
+
+	// Some commands (e.g., top, sudo without -S) need a terminal. Echo is off
+	// so input piped to the command isn't copied into its output
+	if opts.Pty {
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty("xterm", ptyHeight, ptyWidth, modes); err != nil {
+			result.Error = fmt.Errorf("failed to request pty: %v", err)
+			result.Success = false
+			return result
+		}
+	}
+
+	// Execute command
+	if err := session.Start(command); err != nil {
 		result.Error = fmt.Errorf("failed to start command: %v", err)
 		result.Success = false
 		return result
 	}
 
+	start := time.Now()
+
+	// -timeout fails the command, unlike ctx being done which skips the host
+	cmdCtx, cancel := ctx, context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		cmdCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	defer cancel()
+
+	// Stop the command if ctx is done (e.g., -host-timeout) before it exits
+	finished := make(chan struct{})
+	defer close(finished)
+	defer stopOnDone(cmdCtx, client, session, opts, finished)()
+
 	// Read stdout and stderr
-	var stdoutBuilder, stderrBuilder strings.Builder
+	var gunzipErr error
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		io.Copy(&stdoutBuilder, stdoutPipe)
+		stdout := io.MultiWriter(&stdoutBuilder, stdoutSink, streamOut)
+		counted := &countingReader{r: stdoutPipe}
+		if opts.Gunzip {
+			gunzipErr = copyGunzip(stdout, counted)
+		} else {
+			io.Copy(stdout, counted)
+		}
+		result.StdoutBytes = counted.n
 	}()
 
 	go func() {
 		defer wg.Done()
-		io.Copy(&stderrBuilder, stderrPipe)
+		if sudo != nil {
+			n, _ := io.Copy(sudo, stderrPipe)
+			sudo.finish()
+			result.StderrBytes = n - sudo.removed
+			return
+		}
+		result.StderrBytes, _ = io.Copy(io.MultiWriter(&stderrBuilder, stderrSink, streamErr), stderrPipe)
 	}()
 
 	// Wait for command to complete
 	err = session.Wait()
 	wg.Wait()
 
-	result.Stdout = stdoutBuilder.String()
-	result.Stderr = stderrBuilder.String()
+	result.Duration = time.Since(start)
+	result.Slow = opts.WarnAfter > 0 && result.Duration > opts.WarnAfter
+
+	flushWriter(stdoutSink)
+	flushWriter(stderrSink)
+	flushWriter(streamOut)
+	flushWriter(streamErr)
+
+	stderr := stderrBuilder.String()
+	if opts.RemoteTimes {
+		stderr, result.RemoteStart, result.RemoteEnd = parseRemoteTimes(stderr)
+	}
+
+	result.Stdout = maskOutput(stdoutBuilder.String(), opts.Masks)
+	result.Stderr = maskOutput(stderr, opts.Masks)
 
 	if err != nil {
+		if ctx.Err() != nil {
+			return skipResult(result, ctx.Err())
+		}
+		if cmdCtx.Err() != nil {
+			result.Error = fmt.Errorf("command timed out after %s", opts.Timeout)
+			result.Success = false
+			return result
+		}
 		// Check if it's an ExitError (command failed but connection succeeded)
-		if exitErr, ok := err.(*ssh.ExitError); ok {
+		if exitErr, ok := err.(*ssh.ExitError); ok && sudo != nil && sudo.authFailed(exitErr.ExitStatus()) {
+			// Fix the credentials, not the command
+			result.Error = fmt.Errorf("sudo authentication failed for %s", vps.Username)
+			result.ExitCode = exitErr.ExitStatus()
+			result.SudoAuthFailed = true
+			result.Success = false
+		} else if ok {
 			result.Error = fmt.Errorf("command exited with code %d", exitErr.ExitStatus())
+			result.ExitCode = exitErr.ExitStatus()
 			result.Success = false
 		} else {
 			result.Error = fmt.Errorf("command execution error: %v", err)
@@ -285,58 +1124,365 @@ func executeCommand(vps VPS, command string) Result {
 		return result
 	}
 
+	if gunzipErr != nil {
+		result.Error = gunzipErr
+		result.ExitCode = 0
+		result.Success = false
+		return result
+	}
+
 	result.Success = true
+	result.ExitCode = 0
 	return result
 }
 
+// hostTask performs one unit of work (command, upload, ...) against a VPS
+type hostTask func(ctx context.Context, vps VPS) Result
+
+// commandTask returns a hostTask that executes command on each VPS
+func commandTask(command string, opts ExecOptions) hostTask {
+	e := executor(opts)
+	return func(ctx context.Context, vps VPS) Result {
+		return e.Execute(ctx, vps, command)
+	}
+}
+
+// runCommand executes command on every VPS concurrently and returns the results in
+// the same order as vpsList. Set opts.OnResult to handle each result as soon
+// as its host completes instead of waiting for the whole batch
+func runCommand(vpsList []VPS, command string, opts ExecOptions) []Result {
+	return runBatch(vpsList, opts, commandTask(command, opts))
+}
+
+// semaphore bounds how many hosts are worked on at once
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore admitting n holders, unlimited when n <= 0
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// acquire blocks until a slot is free and returns the func releasing it
+func (s semaphore) acquire() func() {
+	if s == nil {
+		return func() {}
+	}
+	s <- struct{}{}
+	return func() { <-s }
+}
+
+// batchContext returns the context of a whole batch, derived from opts.Context
+func batchContext(opts ExecOptions) (context.Context, context.CancelFunc) {
+	if opts.Context != nil {
+		return context.WithCancel(opts.Context)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// hostContext returns the context bounding the work on a single host, derived
+// from the batch context parent. Hosts started after opts.Deadline are skipped
+// without connecting
+func hostContext(parent context.Context, opts ExecOptions) (context.Context, context.CancelFunc) {
+	deadline := opts.Deadline
+	if opts.HostTimeout > 0 {
+		if hostDeadline := time.Now().Add(opts.HostTimeout); deadline.IsZero() || hostDeadline.Before(deadline) {
+			deadline = hostDeadline
+		}
+	}
+	if !deadline.IsZero() {
+		return context.WithDeadline(parent, deadline)
+	}
+	return context.WithCancel(parent)
+}
+
+// runBatch runs the task on every VPS concurrently and returns the results in
+// the same order as vpsList
+func runBatch(vpsList []VPS, opts ExecOptions, task hostTask) []Result {
+	var wg sync.WaitGroup
+	var callbackMu sync.Mutex
+	results := make([]Result, len(vpsList))
+	sem := newSemaphore(opts.Parallel)
+
+	// Cancelled to skip every unfinished host under opts.FailFastConnect
+	batchCtx, abort := batchContext(opts)
+	defer abort()
+
+	for i := range vpsList {
+		// Acquire in target order so hosts start in that order under -parallel
+		release := sem.acquire()
+		wg.Add(1)
+		go func(idx int, vps VPS) {
+			defer wg.Done()
+			defer release()
+
+			ctx, cancel := hostContext(batchCtx, opts)
+			defer cancel()
+
+			results[idx] = task(ctx, vps)
+			results[idx].MatchedBy = vps.selector
+			if opts.FailFastConnect && connectFailed(results[idx]) {
+				abort()
+			}
+			if opts.Transform != "" && results[idx].Success {
+				results[idx] = applyTransform(results[idx], opts.Transform)
+			}
+
+			opts.Progress.record(results[idx])
+			callbackMu.Lock()
+			if opts.OnResult != nil {
+				opts.Progress.clear()
+				opts.OnResult(idx, results[idx])
+			}
+			opts.Progress.show()
+			callbackMu.Unlock()
+		}(i, vpsList[i])
+	}
+
+	wg.Wait()
+	opts.Progress.clear()
+	return results
+}
+
+// orderedPrinter prints results in target order as soon as every earlier
+// result has arrived, so output streams without being interleaved
+type orderedPrinter struct {
+	next    int
+	pending map[int]Result
+	print   func(Result)
+}
+
+// newOrderedPrinter returns an orderedPrinter that prints with fn
+func newOrderedPrinter(fn func(Result)) *orderedPrinter {
+	return &orderedPrinter{pending: make(map[int]Result), print: fn}
+}
+
+// add records the result at position i and flushes everything now in order
+func (p *orderedPrinter) add(i int, result Result) {
+	p.pending[i] = result
+	for {
+		next, ok := p.pending[p.next]
+		if !ok {
+			return
+		}
+		delete(p.pending, p.next)
+		p.print(next)
+		p.next++
+	}
+}
+
+// exitCode computes the process exit code for a finished batch. By default any
+// failure yields 1; with worst set it is the highest remote exit code seen,
+// clamped to 255, where hosts without an exit status count as exitCodeConnFailure
+func exitCode(results []Result, worst bool) int {
+	code := 0
+	for _, result := range results {
+		if result.Success || result.Skipped {
+			continue
+		}
+		if !worst {
+			return 1
+		}
+		hostCode := result.ExitCode
+		if hostCode < 0 || hostCode > 255 {
+			hostCode = exitCodeConnFailure
+		}
+		if hostCode == 0 {
+			// Failed without a non-zero remote status, still a failure
+			hostCode = 1
+		}
+		if hostCode > code {
+			code = hostCode
+		}
+	}
+	return code
+}
+
 // printResult prints a formatted result
-func printResult(result Result) {
-	status := "SUCCESS"
-	if !result.Success {
-		status = "FAILED"
+func printResult(result Result, color bool) {
+	writeResult(os.Stdout, result, color)
+}
+
+// writeResult writes a formatted result to w, with SUCCESS in green and
+// FAILED in red when color is enabled
+func writeResult(w io.Writer, result Result, color bool) {
+	status := colorize("SUCCESS", colorGreen, color)
+	if result.Skipped {
+		status = "SKIPPED"
+	} else if !result.Success {
+		status = colorize("FAILED", colorRed, color)
+	}
+
+	if result.Slow {
+		status += fmt.Sprintf(" (SLOW: %s)", result.Duration.Round(time.Second))
 	}
 
-	fmt.Printf("[%s] %s\n", result.VPS.Name, status)
+	fmt.Fprintf(w, "[%s] %s\n", result.VPS.Name, status)
 
 	if result.Stdout != "" {
-		fmt.Println("STDOUT:")
-		fmt.Println(result.Stdout)
+		fmt.Fprintln(w, "STDOUT:")
+		fmt.Fprintln(w, result.Stdout)
 	}
 
 	if result.Stderr != "" {
-		fmt.Println("STDERR:")
-		fmt.Println(result.Stderr)
+		fmt.Fprintln(w, "STDERR:")
+		fmt.Fprintln(w, result.Stderr)
 	}
 
-	if result.Error != nil && result.Success == false {
-		if result.Stderr == "" {
-			fmt.Println("STDERR:")
-		}
-		fmt.Printf("%v\n", result.Error)
+	if result.TransformError != nil {
+		fmt.Fprintf(w, "TRANSFORM ERROR: %v\n", result.TransformError)
+	}
+
+	if !result.RemoteStart.IsZero() {
+		fmt.Fprintln(w, formatRemoteTimes(result))
+	}
+
+	// The error is axion's own verdict, not part of the remote stderr
+	if result.Error != nil && !result.Success {
+		fmt.Fprintf(w, "ERROR: %v\n", result.Error)
+	}
+
+	if result.Cleanup != nil {
+		cleanup := *result.Cleanup
+		cleanup.VPS.Name = result.VPS.Name + " cleanup"
+		writeResult(w, cleanup, color)
 	}
 }
 
 func main() {
 	// Parse CLI flags
 	var indexFlag = flag.String("i", "", "VPS index(es): single number or comma-separated (e.g., 42 or 52,42,53)")
-	var rangeFlag = flag.String("l", "", "VPS range (e.g., 1-20)")
-	var commandFlag = flag.String("c", "", "Command to execute (required)")
+	var rangeFlag = flag.String("l", "", "VPS range, optionally with inline exclusions (e.g., 1-20 or '1-50!7,12')")
+	var namesFlag = flag.String("n", "", "VPS name(s), comma-separated with brace expansion (e.g., worker{1..3},db{a,b})")
+	var promptFlag = flag.Bool("prompt", false, "Prompt for the command on the terminal when -c is not given.")
+	var tagFlags stringList
+	flag.Var(&tagFlags, "tag", "VPS entries carrying this tag (e.g., scanner or role=scanner); repeat to select entries with any of the tags.")
+	var patternFlag = flag.String("name", "", "VPS names matching a glob (e.g., 'db-*') or a /regex/ (e.g., '/^eu-west-[0-9]+$/')")
+	var excludeFlag = flag.String("exclude", "", "Skip VPS with these numbers in the selection (e.g., 37,40-42)")
+	var allFlag = flag.Bool("all", false, "Run on every VPS in the config.")
+	var hostsFile = flag.String("hosts-file", "", "File of extra hosts for this run, one 'name ip username password' or 'ip' (using the config defaults) per line. Targeted when no selector is given.")
+	var posFlag = flag.String("pos", "", "VPS by 1-based position in the config file, NOT by name number (e.g., 3,5)")
+	var lowestFlag = flag.Int("lowest", 0, "Keep only the N lowest-numbered hosts of the selection (or of the whole config).")
+	var highestFlag = flag.Int("highest", 0, "Keep only the N highest-numbered hosts of the selection (or of the whole config).")
+	var requireAll = flag.Bool("require-all", false, "Fail without running anything if any -i index, -l number or -n name is not found.")
+	flag.BoolVar(requireAll, "strict", false, "Same as -require-all.")
+	var convergeFile = flag.String("converge", "", "State file of hosts that already succeeded: target only the others (narrows -i/-l/-n, or the whole config) and record new successes.")
+	var commandFlags stringList
+	flag.Var(&commandFlags, "c", "Command to execute (required), or - to read it from stdin. Repeat to run several commands in order over one connection per host, stopping at the first failure.")
+	var scriptFile = flag.String("script", "", "Run the contents of this file as the command.")
+	var configFlag = flag.String("config", "", "Config file path or HTTP(S) URL (default $XDG_CONFIG_HOME/axion/config.yaml, then "+configPath+").")
+	var configHeaderFlags stringList
+	flag.Var(&configHeaderFlags, "config-header", "HTTP header sent when -config is a URL, as 'Name: value' (repeatable).")
+	var sshConfigFile = flag.String("ssh-config", "", "OpenSSH client config (e.g., ~/.ssh/config) whose Host blocks fill in the HostName, Port, User and IdentityFile that entries leave out, matched by entry name.")
+	var credsOverrideFile = flag.String("creds-override", "", "YAML file mapping VPS names to username/password/secret/port that override the config for this run.")
+	var agentMode = flag.Bool("agent", false, "Run as a long-lived agent keeping SSH connections warm for -use-agent.")
+	var agentSocket = flag.String("agent-socket", defaultAgentSocket(), "Unix socket of the agent.")
+	var agentTTL = flag.Duration("agent-ttl", 5*time.Minute, "Close agent connections idle for longer than this.")
+	var useAgent = flag.Bool("use-agent", false, "Run commands over warm connections from the agent (falls back to direct connections when none is running).")
+	var jsonFlag = flag.Bool("json", false, "Print each host's result as one JSON object per line (NDJSON), without the banner.")
+	var jsonArray = flag.Bool("json-array", false, "With -json, print all results as a single JSON array instead.")
+	var csvFlag = flag.Bool("csv", false, "Print results as CSV (name, ip, success, exit_code, error and the first line of stdout), without the banner.")
 	var silent = flag.Bool("silent", false, "Silent mode.")
+	var quiet = flag.Bool("quiet", false, "Print successful hosts as just their status line; failed hosts keep their full output and error.")
 	var version = flag.Bool("version", false, "Print the version of the tool and exit.")
+	var uptimeMode = flag.Bool("uptime", false, "Report uptime and load averages as a table instead of running -c.")
+	var factsMode = flag.Bool("facts", false, "Gather OS, kernel, CPU count, memory and free disk from each host instead of running -c.")
+	var factsFormat = flag.String("facts-format", "table", "Output format for -facts: table or json.")
+	var versionCheck = flag.Bool("version-check", false, "Run -version-cmd on each host and flag hosts whose version differs from -expect-version.")
+	var versionCmd = flag.String("version-cmd", defaultVersionCommand, "Command that prints the remote version, used by -version-check.")
+	var expectVersion = flag.String("expect-version", banner.Version, "Expected version for -version-check.")
+	var cmdPrefix = flag.String("cmd-prefix", "", "Shell snippet run before -c on every host (e.g., \"date\").")
+	var cmdSuffix = flag.String("cmd-suffix", "", "Shell snippet run after -c on every host; the exit code of -c is preserved (e.g., \"echo EXIT=$?\").")
+	var umaskFlag = flag.String("umask", "", "Run -c with this octal umask on every host (e.g., 027).")
+	var ulimitFlag = flag.String("ulimit", "", "Run -c with this open files limit (ulimit -n) on every host (e.g., 65536).")
+	var rawMode = flag.Bool("raw", false, "Send -c verbatim to the SSH exec channel, without any command wrapping.")
+	var sudo = flag.Bool("sudo", false, "Run -c through sudo (as each host's sudo_user, default root), feeding the VPS password on stdin.")
+	var onFailure = flag.String("on-failure", "", "Cleanup command run on a host (same connection) when -c exits non-zero there.")
+	var learnHosts = flag.String("learn-hosts", "", "Connect to each target without verification and record its host key in this known_hosts file instead of running -c.")
+	var uploadFlag = flag.String("upload", "", "Upload a local file to every selected VPS over SFTP (LOCAL:REMOTE), keeping its mode. With -c, the command runs after the upload.")
+	var verifyUpload = flag.Bool("verify", false, "With -upload, compare the remote sha256sum against the local file and fail hosts that differ.")
+	var timeBudget = flag.Duration("time-budget", 0, "Fit the whole run into this duration (e.g., 10m), splitting it into per-host timeouts and skipping hosts that would overrun it.")
+	var keepalive = flag.Duration("keepalive", 0, "Send a keepalive request on every connection at this interval (e.g., 30s) so NAT and firewalls don't drop idle long-running commands.")
+	var retries = flag.Int("retries", 0, "Retry a host's connection this many times after a transient failure (refused, reset, timeout); commands are never retried.")
+	var retryDelay = flag.Duration("retry-delay", time.Second, "Wait before the first connection retry, doubled after each retry.")
+	var timeout = flag.Duration("timeout", 0, "Fail a host whose connection or command takes longer than this (e.g., 30s).")
+	var knownHosts = flag.String("known-hosts", defaultKnownHosts(), "known_hosts file to verify host keys against.")
+	var insecure = flag.Bool("insecure", false, "Accept any host key without verification (MITM risk).")
+	var hostTimeout = flag.Duration("host-timeout", 0, "Skip a single host that runs longer than this (e.g., 5m) without failing the batch.")
+	var bindAddr = flag.String("bind-addr", "", "Local source IP (or IP:port) for outbound SSH connections.")
+	var confirm = flag.Bool("confirm", false, "Show the targets and the command and ask for 'yes' on stdin before running anything.")
+	var yes = flag.Bool("yes", false, "Answer yes to -confirm, for scripts and CI.")
+	var forwardFlag = flag.String("forward", "", "Forward a local port to an address reachable from the single selected VPS (LOCAL:REMOTE, e.g., 8080:5432 or 8080:db.internal:5432) until Ctrl-C.")
+	var dryRun = flag.Bool("dry-run", false, "List the hosts the selectors resolved to, without connecting to any of them.")
+	var summaryOnly = flag.Bool("summary-only", false, "Don't print per-host output, only the failed hosts and the summary line.")
+	var jumpFlag = flag.String("jump", "", "Reach every VPS through this bastion ([user@]host[:port]; host is a config entry name or IP providing the credentials).")
+	var pty = flag.Bool("pty", false, "Run the command in a pseudo-terminal (xterm, 80x24); stderr is merged into stdout.")
+	var stream = flag.Bool("stream", false, "Print output lines live, prefixed with the VPS name, instead of each host's output once it finishes.")
+	var pager = flag.Bool("pager", false, "Page single-host output through $PAGER (default less) when stdout is a terminal.")
+	var stdinFile = flag.String("stdin", "", "Pipe the contents of this file to each host's command.")
+	var stdinDir = flag.String("stdin-dir", "", "Pipe <dir>/<name> to each host's command (per-host data).")
+	var outDir = flag.String("outdir", "", "Also write each host's output to <dir>/<name>.stdout and <name>.stderr.")
+	var envFlags stringList
+	flag.Var(&envFlags, "env", "Environment variable for the command as KEY=VALUE (repeatable); exported in the command when sshd rejects it.")
+	var maskFlags stringList
+	flag.Var(&maskFlags, "mask", "Regex whose matches are replaced with *** in all output (repeatable).")
+	var validate = flag.Bool("validate", false, "Check the config (duplicate names and addresses, names -i/-l can't select) and exit non-zero on errors.")
+	flag.BoolVar(validate, "check-config", false, "Same as -validate.")
+	var exportFormat = flag.String("export", "", "Write the config inventory to stdout as csv or json and exit.")
+	var exportSecrets = flag.Bool("export-secrets", false, "Include passwords and secrets in -export output instead of redacting them.")
+	var clientVersion = flag.String("client-version", "", "Custom SSH client identification string, must start with SSH-2.0- (e.g., SSH-2.0-axion).")
+	var noColor = flag.Bool("no-color", false, "Don't color the SUCCESS/FAILED status and the failed hosts table (color is only used on a terminal).")
+	var sortBy = flag.String("sort", "", "Print results sorted by number, name or status (failures first) instead of in target order.")
+	var groupBy = flag.String("group-results-by", "", "Group printed results by the value of this tag key (tags like role=scanner).")
+	var failFastConnect = flag.Bool("fail-fast-connect", false, "Abort the whole run as soon as any host fails to connect or authenticate; command failures don't abort.")
+	var latencyAware = flag.Bool("latency-aware", false, "Probe each host's latency first and scale its connect timeout to it.")
+	var latencyFactor = flag.Float64("latency-factor", 20, "Connect timeout as a multiple of the measured round trip time, for -latency-aware.")
+	var latencyMin = flag.Duration("latency-min", 3*time.Second, "Lower bound of -latency-aware connect timeouts.")
+	var latencyMax = flag.Duration("latency-max", 30*time.Second, "Upper bound of -latency-aware connect timeouts (and of the probe).")
+	var abortIfUnreachable = flag.Bool("abort-if-unreachable", false, "Probe the SSH port of every target first and run nothing if any host is unreachable.")
+	var preflightTimeout = flag.Duration("preflight-timeout", 5*time.Second, "Per-host TCP timeout for -abort-if-unreachable.")
+	var verbose = flag.Bool("verbose", false, "Print extra diagnostics, such as the connection attempt history per host.")
+	var gunzip = flag.Bool("gunzip", false, "Decompress gzip stdout on the fly (e.g., -c \"cat app.log.gz\").")
+	var killSignal = flag.String("kill-signal", "", "Signal (e.g., TERM, KILL) sent to a command stopped by -host-timeout before its session is closed.")
+	var killGrace = flag.Duration("kill-grace", 5*time.Second, "How long a command may take to exit after -kill-signal before its session is closed.")
+	var htmlReport = flag.String("html", "", "Write a self-contained HTML report of the results to this file.")
+	var summaryJSON = flag.String("summary-json", "", "Write a compact JSON summary (counts and failed hosts) to this file, or - for stdout.")
+	var anomalyMode = flag.Bool("anomaly", false, "Print only hosts whose output differs from the majority of hosts.")
+	var dedupe = flag.Bool("dedupe", false, "Print each distinct output (and exit code) once, with the hosts that produced it.")
+	var remoteTimes = flag.Bool("remote-times", false, "Record when the command started and finished on the remote clock.")
+	var warnAfter = flag.Duration("warn-after", 0, "Flag hosts whose command runs longer than this (e.g., 2m) as slow, without failing them.")
+	var transform = flag.String("transform", "", "Local shell command each host's stdout is piped through before printing (e.g., \"jq .version\").")
+	var parallel = flag.String("parallel", strconv.Itoa(defaultParallel), "Maximum hosts to run at once: a number (0 = all at once), or auto to scale with the host count and open files limit.")
+	var noFail = flag.Bool("no-fail", false, "Exit 0 even if hosts fail; only axion's own errors (config, selectors) exit non-zero.")
+	var exitWorst = flag.Bool("exit-worst", false, "Exit with the highest remote exit code seen (255 for connection failures) instead of 1.")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nEither -i or -l must be provided (not both).\n")
+		fmt.Fprintf(os.Stderr, "\nExactly one of -i, -l, -n, -name, -tag, -pos or -all must be provided, unless -hosts-file lists the targets or -lowest/-highest or -converge picks from the whole config.\n")
 		fmt.Fprintf(os.Stderr, "Examples:\n")
 		fmt.Fprintf(os.Stderr, "  %s -i 42 -c \"uptime\"\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i 52,42,53 -c \"tmux ls\"\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -l 1-20 -c \"df -h\"\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -n worker{1..3},db{a,b} -c \"hostname\"\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -l 1-20 -uptime\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -lowest 3 -c \"systemctl restart app\"\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -l 1-20 -upload app.tar.gz:/opt/app.tar.gz -verify\n", os.Args[0])
 	}
 
 	flag.Parse()
 
+	// The first -c goes through every mode below, any others run after it as
+	// a sequence on the same connection
+	commandFlag := new(string)
+	var moreCommands []string
+	if len(commandFlags) > 0 {
+		*commandFlag, moreCommands = commandFlags[0], commandFlags[1:]
+	}
+
 	// Print version and exit if -version flag is provided
 	if *version {
 		banner.PrintBanner()
@@ -344,166 +1490,1097 @@ func main() {
 		return
 	}
 
+	if *agentMode {
+		if err := runAgent(*agentSocket, *agentTTL); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	configHeaders, err := parseConfigHeaders(configHeaderFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *configFlag == "" {
+		*configFlag = defaultConfigPath()
+	}
+
+	var sshConfig *ssh_config.Config
+	if *sshConfigFile != "" {
+		sshConfig, err = loadSSHConfig(*sshConfigFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Check the config and exit
+	if *validate {
+		vpsList, err := loadConfig(*configFlag, configHeaders, sshConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !writeConfigReport(os.Stdout, *configFlag, vpsList) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Export the inventory and exit, without a banner so output stays parseable
+	if *exportFormat != "" {
+		vpsList, err := loadConfig(*configFlag, configHeaders, sshConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := exportInventory(os.Stdout, vpsList, *exportFormat, *exportSecrets); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Don't Print banner if -silnet flag is provided
-	if !*silent {
+	// JSON and CSV output must stay parseable
+	jsonOut := *jsonFlag || *jsonArray
+	machineOut := jsonOut || *csvFlag
+	if !*silent && !machineOut {
 		banner.PrintBanner()
 	}
 
 	// Validate arguments
-	if *indexFlag == "" && *rangeFlag == "" {
-		fmt.Fprintf(os.Stderr, "Error: either -i or -l must be provided\n")
-		flag.Usage()
-		os.Exit(1)
+	selectors := 0
+	for _, set := range []bool{*indexFlag != "", *rangeFlag != "", *namesFlag != "", *patternFlag != "", len(tagFlags) > 0, *posFlag != "", *allFlag} {
+		if set {
+			selectors++
+		}
 	}
 
-	if *indexFlag != "" && *rangeFlag != "" {
-		fmt.Fprintf(os.Stderr, "Error: -i and -l cannot be used together\n")
-		flag.Usage()
+	if *latencyAware && (*latencyFactor <= 0 || *latencyMin <= 0 || *latencyMax < *latencyMin) {
+		fmt.Fprintf(os.Stderr, "Error: -latency-aware needs a positive -latency-factor and 0 < -latency-min <= -latency-max\n")
 		os.Exit(1)
 	}
 
-	if *commandFlag == "" {
-		fmt.Fprintf(os.Stderr, "Error: -c is required and must be non-empty\n")
-		flag.Usage()
+	if *timeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -timeout must not be negative\n")
 		os.Exit(1)
 	}
 
-	// Load config
-	vpsList, err := loadConfig(configPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if *keepalive < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -keepalive must not be negative\n")
 		os.Exit(1)
 	}
 
-	if len(vpsList) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: config file contains no VPS entries\n")
+	if *retries < 0 || *retryDelay < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -retries and -retry-delay must not be negative\n")
 		os.Exit(1)
 	}
 
-	// Execute command
-	if *indexFlag != "" {
-		// Check if it's comma-separated or single index
-		if strings.Contains(*indexFlag, ",") {
-			// Multiple VPS execution - comma-separated indices
-			indices, err := parseCommaSeparatedIndices(*indexFlag)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
-
-			matchedVPS, err := findVPSByIndices(vpsList, indices)
-			if err != nil {
-				// Print warning but continue with found VPS
-				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
-			}
-
-			if len(matchedVPS) == 0 {
-				fmt.Fprintf(os.Stderr, "Error: no VPS entries found\n")
-				os.Exit(1)
-			}
-
-			// Execute commands concurrently
-			var wg sync.WaitGroup
-			results := make([]Result, len(matchedVPS))
+	if *timeBudget < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -time-budget must not be negative\n")
+		os.Exit(1)
+	}
 
-			for i := range matchedVPS {
-				wg.Add(1)
-				currentIndex := i
+	if *lowestFlag < 0 || *highestFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -lowest and -highest must be >= 1\n")
+		os.Exit(1)
+	}
 
-				go func(idx int, vps VPS) {
-					defer wg.Done()
-					results[idx] = executeCommand(vps, *commandFlag)
-				}(currentIndex, matchedVPS[i])
-			}
+	if *lowestFlag > 0 && *highestFlag > 0 {
+		fmt.Fprintf(os.Stderr, "Error: -lowest and -highest cannot be used together\n")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-			wg.Wait()
+	rankSelect := *lowestFlag > 0 || *highestFlag > 0
 
-			// Print results
-			for _, result := range results {
-				printResult(result)
-				fmt.Println() // Blank line between results
-			}
+	if selectors == 0 && !rankSelect && *convergeFile == "" && *hostsFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: one of -i, -l, -n, -name, -tag, -pos, -all or -hosts-file must be provided\n")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-			// Check if any failed
-			hasFailure := false
-			for _, result := range results {
-				if !result.Success {
-					hasFailure = true
-					break
-				}
-			}
+	if selectors > 1 {
+		fmt.Fprintf(os.Stderr, "Error: -i, -l, -n, -name, -tag, -pos and -all cannot be used together\n")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-			if hasFailure {
-				os.Exit(1)
-			}
-		} else {
-			// Single VPS execution - find by number in name
-			index, err := strconv.Atoi(strings.TrimSpace(*indexFlag))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: invalid index '%s': %v\n", *indexFlag, err)
-				os.Exit(1)
-			}
+	// A sequence is made of plain -c commands only
+	if len(moreCommands) > 0 {
+		if *scriptFile != "" || slices.Contains(commandFlags, "-") || *uptimeMode || *versionCheck || *factsMode {
+			fmt.Fprintf(os.Stderr, "Error: repeated -c cannot be combined with -c -, -script, -uptime, -version-check or -facts\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if slices.Contains(commandFlags, "") {
+			fmt.Fprintf(os.Stderr, "Error: -c is required and must be non-empty\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
 
-			vps, err := findVPSByNumber(vpsList, index)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
+	// Multi-line commands come from a script file or stdin, without quoting
+	if *scriptFile != "" && *commandFlag != "" {
+		fmt.Fprintf(os.Stderr, "Error: -c and -script cannot be used together\n")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-			result := executeCommand(*vps, *commandFlag)
-			printResult(result)
+	// Shared by -c -, -prompt and -confirm, so none loses what another buffered
+	stdinReader := bufio.NewReader(os.Stdin)
+	commandFromStdin := *scriptFile == "" && *commandFlag == "-"
 
-			if !result.Success {
-				os.Exit(1)
-			}
-		}
-	} else {
-		// Multiple VPS execution - find by number range in names
-		start, end, err := parseRange(*rangeFlag)
+	if *scriptFile != "" || *commandFlag == "-" {
+		command, err := readCommand(*scriptFile, stdinReader)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		*commandFlag = command
+	}
 
-		matchedVPS, err := findVPSInRange(vpsList, start, end)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if *uptimeMode {
+		if *commandFlag != "" {
+			fmt.Fprintf(os.Stderr, "Error: -c and -uptime cannot be used together\n")
+			flag.Usage()
 			os.Exit(1)
 		}
+		*commandFlag = uptimeCommand
+	}
 
-		// Execute commands concurrently
-		var wg sync.WaitGroup
-		results := make([]Result, len(matchedVPS))
-
-		for i := range matchedVPS {
-			wg.Add(1)
-			currentIndex := i
-
-			go func(idx int, vps VPS) {
-				defer wg.Done()
-				results[idx] = executeCommand(vps, *commandFlag)
-			}(currentIndex, matchedVPS[i])
+	if *versionCheck {
+		if *commandFlag != "" {
+			fmt.Fprintf(os.Stderr, "Error: -c cannot be combined with -version-check or -uptime\n")
+			flag.Usage()
+			os.Exit(1)
 		}
+		*commandFlag = *versionCmd
+	}
 
-		wg.Wait()
+	if *factsMode {
+		if *commandFlag != "" {
+			fmt.Fprintf(os.Stderr, "Error: -c cannot be combined with -facts, -version-check or -uptime\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if *factsFormat != "table" && *factsFormat != "json" {
+			fmt.Fprintf(os.Stderr, "Error: invalid -facts-format '%s': expected table or json\n", *factsFormat)
+			os.Exit(1)
+		}
+		*commandFlag = factsScript
+	}
 
-		// Print results
-		for _, result := range results {
-			printResult(result)
-			fmt.Println() // Blank line between results
+	if *sortBy != "" {
+		if err := parseResultSort(*sortBy); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
+	}
 
-		// Check if any failed
-		hasFailure := false
-		for _, result := range results {
-			if !result.Success {
-				hasFailure = true
-				break
-			}
+	var upload *UploadSpec
+	if *uploadFlag != "" {
+		if *uptimeMode || *versionCheck || *factsMode {
+			fmt.Fprintf(os.Stderr, "Error: -upload cannot be combined with -uptime, -version-check or -facts\n")
+			flag.Usage()
+			os.Exit(1)
 		}
 
-		if hasFailure {
+		spec, err := parseUploadSpec(*uploadFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		if *verifyUpload {
+			spec.Verify = true
+			spec.SHA256, err = fileSHA256(spec.LocalPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to hash %s: %v\n", spec.LocalPath, err)
+				os.Exit(1)
+			}
+		}
+		upload = &spec
+	} else if *verifyUpload {
+		fmt.Fprintf(os.Stderr, "Error: -verify requires -upload\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *learnHosts != "" && (*commandFlag != "" || upload != nil) {
+		fmt.Fprintf(os.Stderr, "Error: -learn-hosts cannot be combined with -c, -upload or other command modes\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// -forward runs no command, it only holds a tunnel open
+	var forward *forwardSpec
+	if *forwardFlag != "" {
+		if *commandFlag != "" || upload != nil || *learnHosts != "" || *useAgent || machineOut {
+			fmt.Fprintf(os.Stderr, "Error: -forward cannot be combined with -c, -upload, -learn-hosts, -uptime, -version-check, -facts, -use-agent, -json or -csv\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		var err error
+		forward, err = parseForward(*forwardFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(moreCommands) > 0 && (upload != nil || *useAgent) {
+		fmt.Fprintf(os.Stderr, "Error: repeated -c cannot be combined with -upload or -use-agent\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// -upload on its own runs no command; with -c the command follows the upload
+	uploadOnly := upload != nil && *commandFlag == ""
+
+	// Ask for the command interactively, only when a user can answer
+	if *commandFlag == "" && upload == nil && *learnHosts == "" && forward == nil && *promptFlag && isTerminal(os.Stdin) {
+		command, err := promptCommand(stdinReader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		*commandFlag = command
+	}
+
+	if *commandFlag == "" && upload == nil && *learnHosts == "" && forward == nil {
+		fmt.Fprintf(os.Stderr, "Error: -c is required and must be non-empty\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *summaryOnly && (machineOut || *stream || *uptimeMode || *versionCheck || *factsMode || *learnHosts != "" || *anomalyMode || *groupBy != "") {
+		fmt.Fprintf(os.Stderr, "Error: -summary-only cannot be combined with -json, -csv, -stream, -uptime, -version-check, -facts, -learn-hosts, -anomaly or -group-results-by\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if jsonOut && (*uptimeMode || *versionCheck || *factsMode || *learnHosts != "" || *anomalyMode || *groupBy != "") {
+		fmt.Fprintf(os.Stderr, "Error: -json cannot be combined with -uptime, -version-check, -facts, -learn-hosts, -anomaly or -group-results-by\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *csvFlag && (jsonOut || *stream || *uptimeMode || *versionCheck || *factsMode || *learnHosts != "" || *anomalyMode || *dedupe || *groupBy != "") {
+		fmt.Fprintf(os.Stderr, "Error: -csv cannot be combined with -json, -stream, -uptime, -version-check, -facts, -learn-hosts, -anomaly, -dedupe or -group-results-by\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *anomalyMode && (*uptimeMode || *versionCheck || *factsMode || *learnHosts != "" || *groupBy != "") {
+		fmt.Fprintf(os.Stderr, "Error: -anomaly cannot be combined with -uptime, -version-check, -facts, -learn-hosts or -group-results-by\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *dedupe && (jsonOut || *stream || *summaryOnly || *uptimeMode || *versionCheck || *factsMode || *learnHosts != "" || *anomalyMode || *groupBy != "") {
+		fmt.Fprintf(os.Stderr, "Error: -dedupe cannot be combined with -json, -stream, -summary-only, -uptime, -version-check, -facts, -learn-hosts, -anomaly or -group-results-by\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *quiet && (machineOut || *stream || *anomalyMode || *dedupe) {
+		fmt.Fprintf(os.Stderr, "Error: -quiet cannot be combined with -json, -csv, -stream, -anomaly or -dedupe\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *stdinFile != "" && *stdinDir != "" {
+		fmt.Fprintf(os.Stderr, "Error: -stdin and -stdin-dir cannot be used together\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if (*stdinFile != "" || *stdinDir != "") && (*uptimeMode || *versionCheck || *factsMode || uploadOnly || *learnHosts != "") {
+		fmt.Fprintf(os.Stderr, "Error: -stdin and -stdin-dir only apply to -c commands\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// A terminal merges stderr into stdout and rewrites line endings, and
+	// -sudo watches stderr for sudo's password prompt
+	if *pty && (*remoteTimes || *gunzip || *sudo) {
+		fmt.Fprintf(os.Stderr, "Error: -pty cannot be combined with -remote-times, -gunzip or -sudo\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// What the user asked for, before any wrapping, for reports
+	reportCommand := *commandFlag
+	if len(moreCommands) > 0 {
+		reportCommand = strings.Join(commandFlags, " && ")
+	} else if uploadOnly {
+		reportCommand = "-upload " + *uploadFlag
+	} else if upload != nil {
+		reportCommand = "-upload " + *uploadFlag + " -c " + *commandFlag
+	} else if *learnHosts != "" {
+		reportCommand = "-learn-hosts " + *learnHosts
+	} else if forward != nil {
+		reportCommand = "-forward " + *forwardFlag
+	}
+
+	// -raw sends -c verbatim, so it can't be combined with anything that
+	// rewrites the command
+	if *rawMode {
+		if *uptimeMode || *versionCheck || *factsMode || uploadOnly || *learnHosts != "" {
+			fmt.Fprintf(os.Stderr, "Error: -raw only applies to -c commands\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		// -env falls back to exporting in the command when sshd refuses Setenv
+		if *cmdPrefix != "" || *cmdSuffix != "" || *umaskFlag != "" || *ulimitFlag != "" || *sudo || *remoteTimes || len(envFlags) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: -raw cannot be combined with -cmd-prefix, -cmd-suffix, -umask, -ulimit, -sudo, -remote-times or -env\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	// Instrument user commands only, built-in modes parse their own output
+	commands := append([]string{*commandFlag}, moreCommands...)
+	if !*uptimeMode && !*versionCheck && !*factsMode && !uploadOnly && *learnHosts == "" && forward == nil && !*rawMode {
+		for i := range commands {
+			commands[i] = wrapCommand(commands[i], *cmdPrefix, *cmdSuffix)
+
+			command, err := withLimits(commands[i], *umaskFlag, *ulimitFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			commands[i] = command
+
+			if *remoteTimes {
+				commands[i] = withRemoteTimes(commands[i])
+			}
+		}
+		*commandFlag = commands[0]
+	}
+
+	execOpts := ExecOptions{Timeout: *timeout, HostTimeout: *hostTimeout, OutDir: *outDir, Gunzip: *gunzip, Sudo: *sudo, WarnAfter: *warnAfter, Transform: *transform, OnFailure: *onFailure, RemoteTimes: *remoteTimes, FailFastConnect: *failFastConnect, Retries: *retries, RetryDelay: *retryDelay, Pty: *pty, Keepalive: *keepalive}
+
+	if *killSignal != "" {
+		sig, err := parseKillSignal(*killSignal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		execOpts.KillSignal = sig
+		execOpts.KillGrace = *killGrace
+	}
+
+	// -learn-hosts records keys without verifying them, -dry-run never connects
+	if !*insecure && *learnHosts == "" && !*dryRun {
+		callback, err := verifyHostKeys(*knownHosts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		execOpts.KnownHosts = *knownHosts
+		execOpts.HostKeyCallback = callback
+	}
+
+	if *clientVersion != "" {
+		if err := validateClientVersion(*clientVersion); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		execOpts.ClientVersion = *clientVersion
+	}
+
+	execOpts.Env, err = parseEnv(envFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, pattern := range maskFlags {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -mask pattern '%s': %v\n", pattern, err)
+			os.Exit(1)
+		}
+		execOpts.Masks = append(execOpts.Masks, re)
+	}
+
+	if *stdinFile != "" {
+		data, err := os.ReadFile(*stdinFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read -stdin file: %v\n", err)
+			os.Exit(1)
+		}
+		execOpts.Stdin = data
+	}
+
+	if *stdinDir != "" {
+		if info, err := os.Stat(*stdinDir); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: -stdin-dir %s is not a directory\n", *stdinDir)
+			os.Exit(1)
+		}
+		execOpts.StdinDir = *stdinDir
+	}
+
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create output directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *bindAddr != "" {
+		addr, err := parseBindAddr(*bindAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		execOpts.BindAddr = addr
+	}
+
+	// Load config
+	vpsList, defaults, err := loadConfigWithDefaults(*configFlag, configHeaders, sshConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Ad-hoc hosts join the config for this run only
+	var extraHosts []VPS
+	if *hostsFile != "" {
+		extraHosts, err = loadHostsFile(*hostsFile, defaults, sshConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		vpsList = mergeHosts(vpsList, extraHosts)
+	}
+
+	if len(vpsList) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: config file contains no VPS entries\n")
+		os.Exit(1)
+	}
+
+	// Break-glass credentials take precedence over the config for this run
+	if *credsOverrideFile != "" {
+		overrides, err := loadCredsOverrides(*credsOverrideFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if unknown := applyCredsOverrides(vpsList, overrides); len(unknown) > 0 {
+			sort.Strings(unknown)
+			fmt.Fprintf(os.Stderr, "Warning: credentials override for unknown VPS names: %v\n", unknown)
+		}
+	}
+
+	// One bastion connection is shared by every host
+	if *jumpFlag != "" {
+		if *useAgent || *abortIfUnreachable || *latencyAware {
+			fmt.Fprintf(os.Stderr, "Error: -jump cannot be combined with -use-agent, -abort-if-unreachable or -latency-aware\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		jump, err := newJumpHost(*jumpFlag, vpsList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer jump.close()
+		execOpts.Jump = jump
+	}
+
+	// -i is ambiguous when names share a number (-l selects all of them)
+	if *indexFlag != "" {
+		warnDuplicateNumbers(os.Stderr, vpsList)
+	}
+
+	// Parsed before the selectors, -require-all skips excluded numbers
+	var excludeList numberRanges
+	if *excludeFlag != "" {
+		excludeList, err = parseExcludeList(*excludeFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -exclude: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Resolve target VPS entries
+	var matchedVPS []VPS
+	single := false
+
+	if *indexFlag != "" {
+		// Expand brace patterns (e.g., {1..5},9) before parsing indices
+		if strings.ContainsAny(*indexFlag, "{}") {
+			expanded, err := expandSelector(*indexFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			*indexFlag = strings.Join(expanded, ",")
+		}
+
+		// Check if it's comma-separated or single index
+		if strings.Contains(*indexFlag, ",") {
+			// Multiple VPS execution - comma-separated indices
+			indices, err := parseCommaSeparatedIndices(*indexFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			matchedVPS, err = findVPSByIndices(vpsList, indices)
+			labelSelection(matchedVPS, numberLabel("-i", *indexFlag))
+			if errors.Is(err, errNoNumberedNames) {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err != nil {
+				if *requireAll {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				// Print warning but continue with found VPS
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+
+			if len(matchedVPS) == 0 {
+				fmt.Fprintf(os.Stderr, "Error: no VPS entries found\n")
+				os.Exit(1)
+			}
+		} else {
+			// Single VPS execution - find by number in name
+			index, err := strconv.Atoi(strings.TrimSpace(*indexFlag))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid index '%s': %v\n", *indexFlag, err)
+				os.Exit(1)
+			}
+
+			vps, err := findVPSByNumber(vpsList, index)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			matchedVPS = []VPS{*vps}
+			labelSelection(matchedVPS, numberLabel("-i", *indexFlag))
+			single = true
+		}
+	} else if *namesFlag != "" {
+		// Multiple VPS execution - find by exact names
+		names, err := expandSelector(*namesFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		matchedVPS, err = findVPSByNames(vpsList, names)
+		labelSelection(matchedVPS, func(vps VPS) string { return "-n " + vps.Name })
+		if err != nil {
+			if *requireAll {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			// Print warning but continue with found VPS
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+
+		if len(matchedVPS) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no VPS entries found\n")
+			os.Exit(1)
+		}
+	} else if *patternFlag != "" {
+		// Select by glob or regex on the name, for names without numbers
+		matchedVPS, err = findVPSByPattern(vpsList, *patternFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		labelSelection(matchedVPS, func(VPS) string { return "-name " + *patternFlag })
+		single = len(matchedVPS) == 1
+	} else if len(tagFlags) > 0 {
+		// Select by role rather than by number, any of the tags matches
+		matchedVPS, err = findVPSByTags(vpsList, tagFlags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		labelSelection(matchedVPS, tagLabel(tagFlags))
+		single = len(matchedVPS) == 1
+	} else if *posFlag != "" {
+		// Select by 1-based position in the config file, ignoring names
+		spec := *posFlag
+		if strings.ContainsAny(spec, "{}") {
+			expanded, err := expandSelector(spec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			spec = strings.Join(expanded, ",")
+		}
+
+		positions, err := parseCommaSeparatedIndices(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		matchedVPS, err = findVPSByPositions(vpsList, positions)
+		var inRange []int
+		for _, pos := range positions {
+			if pos <= len(vpsList) {
+				inRange = append(inRange, pos)
+			}
+		}
+		for i := range matchedVPS {
+			matchedVPS[i].selector = fmt.Sprintf("-pos %d", inRange[i])
+		}
+		if err != nil {
+			if *requireAll {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			// Print warning but continue with found VPS
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+
+		if len(matchedVPS) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no VPS entries found\n")
+			os.Exit(1)
+		}
+		single = len(positions) == 1
+	} else if *rangeFlag != "" {
+		// Multiple VPS execution - find by number range in names,
+		// minus any inline exclusions (e.g., 1-50!7,12)
+		rangeSpec, excludeSpec, hasExclusions := strings.Cut(*rangeFlag, "!")
+
+		start, end, err := parseRange(rangeSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var excluded []int
+		if hasExclusions {
+			excluded, err = parseCommaSeparatedIndices(excludeSpec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid exclusion list: %v\n", err)
+				os.Exit(1)
+			}
+			for _, num := range excluded {
+				if num < start || (end != openRangeEnd && num > end) {
+					fmt.Fprintf(os.Stderr, "Warning: excluded number %d is outside range %s\n", num, rangeSpec)
+				}
+			}
+		}
+
+		matchedVPS, err = findVPSInRange(vpsList, start, end)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Gaps in the numbering are skipped silently unless every number is required
+		if *requireAll {
+			skip := append(numbersOf(excluded), excludeList...)
+			if missing := missingNumbers(vpsList, start, end, skip); len(missing) > 0 {
+				fmt.Fprintf(os.Stderr, "Error: VPS numbers not found in range %s: %v\n", rangeSpec, missing)
+				os.Exit(1)
+			}
+		}
+
+		matchedVPS = excludeNumbers(matchedVPS, numbersOf(excluded))
+		labelSelection(matchedVPS, numberLabel("-l", *rangeFlag))
+		if len(matchedVPS) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: every VPS in range %s is excluded\n", rangeSpec)
+			os.Exit(1)
+		}
+	} else if *allFlag {
+		// Every entry, numbered or not
+		matchedVPS = vpsList
+		labelSelection(matchedVPS, func(VPS) string { return "-all" })
+	} else if *hostsFile != "" {
+		// No selector: target exactly the hosts in -hosts-file, as merged
+		names := make([]string, len(extraHosts))
+		for i, host := range extraHosts {
+			names[i] = host.Name
+		}
+		matchedVPS, _ = findVPSByNames(vpsList, names)
+		labelSelection(matchedVPS, func(VPS) string { return "-hosts-file " + *hostsFile })
+		single = len(matchedVPS) == 1
+	} else {
+		// No selector: -lowest/-highest/-converge pick from the whole config
+		matchedVPS = vpsList
+	}
+
+	// Drop hosts taken out with -exclude; numbers that weren't selected are ignored
+	if *excludeFlag != "" {
+		matchedVPS = excludeNumbers(matchedVPS, excludeList)
+		if len(matchedVPS) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: every selected VPS is excluded\n")
+			os.Exit(1)
+		}
+		single = len(matchedVPS) == 1 && single
+	}
+
+	// Drop hosts that already succeeded in a previous -converge run
+	var succeeded map[string]bool
+	if *convergeFile != "" {
+		var err error
+		succeeded, err = loadSuccessSet(*convergeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		matchedVPS = selectPending(matchedVPS, succeeded)
+		labelSelection(matchedVPS, func(VPS) string { return "-converge (not yet in " + *convergeFile + ")" })
+		if len(matchedVPS) == 0 {
+			fmt.Println("All targeted hosts have already succeeded, nothing to do.")
+			return
+		}
+		single = len(matchedVPS) == 1 && single
+	}
+
+	// Narrow to the N lowest/highest numbered hosts
+	if rankSelect {
+		n, highest := *lowestFlag, false
+		if *highestFlag > 0 {
+			n, highest = *highestFlag, true
+		}
+
+		var err error
+		matchedVPS, err = selectByNumberRank(matchedVPS, n, highest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		rank := fmt.Sprintf("-lowest %d", n)
+		if highest {
+			rank = fmt.Sprintf("-highest %d", n)
+		}
+		labelSelection(matchedVPS, func(VPS) string { return rank })
+		single = len(matchedVPS) == 1
+	}
+
+	// Canaries and other high priority hosts go first
+	sortByPriority(matchedVPS)
+
+	if *dryRun {
+		writeDryRun(os.Stdout, matchedVPS, reportCommand)
+		return
+	}
+
+	// Hold a tunnel to the one selected host open until Ctrl-C
+	if forward != nil {
+		if len(matchedVPS) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: -forward needs exactly one host (e.g., -i 42), got %d\n", len(matchedVPS))
+			os.Exit(1)
+		}
+		interrupted, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stopSignals()
+		if err := runForward(interrupted, matchedVPS[0], forward, execOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Last chance to catch a wrong selection before anything runs
+	if *confirm && !*yes {
+		// Stdin is used up when it carried the command, ask the terminal
+		in := io.Reader(stdinReader)
+		if commandFromStdin {
+			tty, err := os.Open("/dev/tty")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: -confirm needs a terminal to answer on when -c - reads the command from stdin (pass -yes to skip it): %v\n", err)
+				os.Exit(1)
+			}
+			defer tty.Close()
+			in = tty
+		}
+		ok, err := confirmRun(in, matchedVPS, reportCommand)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Aborted, nothing was run (pass -yes to skip the confirmation).\n")
+			os.Exit(1)
+		}
+	}
+
+	execOpts.Parallel, err = parseParallel(*parallel, len(matchedVPS))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Fit the whole batch into -time-budget: each wave of hosts gets an equal
+	// share, and nothing may run past the end of the budget
+	if *timeBudget > 0 {
+		share := budgetHostTimeout(*timeBudget, len(matchedVPS), execOpts.Parallel)
+		if execOpts.HostTimeout == 0 || share < execOpts.HostTimeout {
+			execOpts.HostTimeout = share
+		}
+		execOpts.Deadline = time.Now().Add(*timeBudget)
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Time budget %s: at most %s per host\n", *timeBudget, execOpts.HostTimeout)
+		}
+	}
+
+	// Preflight: every target must accept TCP connections on its SSH port
+	if *abortIfUnreachable {
+		if unreachable := probeReachability(matchedVPS, *preflightTimeout, execOpts); len(unreachable) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: %d of %d hosts unreachable, aborting without running anything:\n%s", len(unreachable), len(matchedVPS), formatUnreachable(unreachable))
+			os.Exit(1)
+		}
+	}
+
+	// Far-away hosts get longer connect timeouts than nearby ones
+	if *latencyAware {
+		applyLatencyTimeouts(matchedVPS, *latencyFactor, *latencyMin, *latencyMax, execOpts)
+	}
+
+	// Statuses are colored on a terminal, never when piped
+	color := !*noColor && isTerminal(os.Stdout)
+
+	// Plain output is printed as hosts complete, other modes need every result
+	paged := *pager && len(matchedVPS) == 1 && isTerminal(os.Stdout) && !machineOut && !*stream && !*summaryOnly
+	streamed := !*summaryOnly && !*uptimeMode && !*versionCheck && !*factsMode && *learnHosts == "" && !*anomalyMode && !*dedupe && *groupBy == "" && !paged && !*jsonArray && !*csvFlag && *sortBy == ""
+	if *stream && (!streamed || jsonOut || *useAgent || uploadOnly) {
+		fmt.Fprintf(os.Stderr, "Error: -stream only works with plain command output\n")
+		os.Exit(1)
+	}
+	// Streamed lines are shown as they arrive, before there is anything to transform
+	if *stream && *transform != "" {
+		fmt.Fprintf(os.Stderr, "Error: -stream cannot be combined with -transform\n")
+		os.Exit(1)
+	}
+
+	// -quiet prints successes without the blank line after them, so a run of
+	// them ending the output still needs one before the failure table
+	quietGap := false
+
+	if *stream {
+		// Output was already shown line by line, just report how each host ended
+		printer := &streamPrinter{}
+		execOpts.Stream = printer
+		execOpts.OnResult = func(_ int, result Result) {
+			result.Stdout, result.Stderr = "", ""
+			if result.Cleanup != nil {
+				// The -on-failure command was streamed too
+				cleanup := *result.Cleanup
+				cleanup.Stdout, cleanup.Stderr = "", ""
+				result.Cleanup = &cleanup
+			}
+			var buf bytes.Buffer
+			writeResult(&buf, result, color)
+			if !single {
+				buf.WriteString("\n") // Blank line between results
+			}
+			printer.printf(os.Stdout, "%s", buf.String())
+		}
+	} else if streamed && jsonOut {
+		printer := newOrderedPrinter(func(result Result) {
+			writeJSONLine(os.Stdout, result)
+		})
+		execOpts.OnResult = printer.add
+	} else if streamed {
+		printer := newOrderedPrinter(func(result Result) {
+			if *quiet {
+				result = quietResult(result)
+			}
+			printResult(result, color)
+			quietGap = *quiet && result.Success
+			if !single && !quietGap {
+				fmt.Println() // Blank line between results
+			}
+		})
+		execOpts.OnResult = printer.add
+	}
+
+	// Long batches show how many hosts are done, only for a person watching
+	if len(matchedVPS) > 1 && !machineOut && !*silent && !*stream && isTerminal(os.Stderr) {
+		execOpts.Progress = newProgressMeter(os.Stderr, len(matchedVPS))
+	}
+
+	// Ctrl-C (or SIGTERM) stops running commands and skips the remaining
+	// hosts; a second one exits right away
+	interrupted, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	context.AfterFunc(interrupted, stopSignals)
+	execOpts.Context = interrupted
+
+	// Execute commands (or upload) concurrently
+	var results []Result
+	if *learnHosts != "" {
+		results = runBatch(matchedVPS, execOpts, learnHostKeyTask(execOpts))
+	} else if upload != nil {
+		results = runBatch(matchedVPS, execOpts, uploadTask(*upload, *commandFlag, execOpts))
+	} else if *useAgent {
+		results = runBatch(matchedVPS, execOpts, agentTask(*agentSocket, *commandFlag, execOpts))
+	} else if len(commands) > 1 {
+		results = runBatch(matchedVPS, execOpts, sequenceTask(commands, execOpts))
+	} else {
+		results = runCommand(matchedVPS, *commandFlag, execOpts)
+	}
+
+	if *outDir != "" {
+		if err := truncateUnrunOutput(*outDir, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	sortResults(results, *sortBy)
+
+	// Print results
+	if *uptimeMode {
+		applyUptime(results)
+		printUptimeTable(results)
+	} else if *versionCheck {
+		applyVersionCheck(results, *expectVersion)
+		printVersionTable(results, *expectVersion)
+	} else if *learnHosts != "" {
+		if err := checkLearnedKeys(*learnHosts, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		writeLearnReport(os.Stdout, results)
+		added, err := writeLearnedHosts(*learnHosts, results)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nRecorded %d new host key(s) in %s\n", added, *learnHosts)
+	} else if *factsMode {
+		applyFacts(results)
+		if *factsFormat == "json" {
+			if err := writeFactsJSON(os.Stdout, results); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to write facts: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			writeFactsTable(os.Stdout, results)
+		}
+	} else if *jsonArray {
+		if err := writeJSONArray(os.Stdout, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write JSON: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *csvFlag {
+		if err := writeCSV(os.Stdout, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write CSV: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *anomalyMode {
+		writeAnomalies(os.Stdout, results, color)
+	} else if *dedupe {
+		writeDeduped(os.Stdout, results)
+	} else if *groupBy != "" {
+		if *quiet {
+			printGroupedResults(quietResults(results), *groupBy, color)
+		} else {
+			printGroupedResults(results, *groupBy, color)
+		}
+	} else if paged {
+		var buf bytes.Buffer
+		if *quiet {
+			writeResult(&buf, quietResult(results[0]), color)
+		} else {
+			writeResult(&buf, results[0], color)
+		}
+		if err := pageOutput(buf.Bytes()); err != nil {
+			// Fall back to plain output if the pager can't be run
+			os.Stdout.Write(buf.Bytes())
+		}
+	} else if *sortBy != "" && !*summaryOnly {
+		for _, result := range results {
+			if jsonOut {
+				writeJSONLine(os.Stdout, result)
+				continue
+			}
+			if *quiet {
+				result = quietResult(result)
+			}
+			printResult(result, color)
+			quietGap = *quiet && result.Success
+			if !single && !quietGap {
+				fmt.Println() // Blank line between results
+			}
+		}
+	}
+
+	if quietGap && !single {
+		fmt.Println()
+	}
+
+	// Diagnostics go to stderr when stdout carries JSON or CSV
+	report := os.Stdout
+	if machineOut {
+		report = os.Stderr
+	}
+
+	if *verbose {
+		writeSelectionReport(report, results)
+		writeRetryReport(report, results)
+		writeOutputReport(report, results)
+		if len(execOpts.Env) > 0 {
+			writeEnvReport(report, results)
+		}
+	}
+
+	// At-a-glance view of what broke after a multi-host run
+	if (len(results) > 1 || *summaryOnly) && !machineOut {
+		writeFailureTable(os.Stdout, results, color)
+		writeSummaryLine(os.Stdout, results)
+	}
+
+	if *warnAfter > 0 {
+		writeSlowReport(os.Stderr, results, *warnAfter)
+	}
+
+	if *failFastConnect {
+		writeConnectAbort(os.Stderr, results)
+	}
+
+	if *htmlReport != "" {
+		if err := writeHTMLReport(*htmlReport, reportCommand, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *summaryJSON != "" {
+		if err := writeSummaryJSON(*summaryJSON, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *convergeFile != "" {
+		if err := recordSuccesses(*convergeFile, results, succeeded); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if interrupted.Err() != nil {
+		fmt.Fprint(os.Stderr, "Interrupted. ")
+		writeSummaryLine(os.Stderr, results)
+		os.Exit(exitCodeInterrupted)
+	}
+
+	// Host failures are reported above; -no-fail keeps them out of the exit code
+	if *noFail {
+		return
+	}
+
+	if code := exitCode(results, *exitWorst); code != 0 {
+		os.Exit(code)
 	}
 }
@@ -4,8 +4,11 @@ import (
 	"fmt"
 )
 
+// Version is the current axion version
+const Version = "v0.0.1"
+
 // prints the version message
-const version = "v0.0.1"
+const version = Version
 
 func PrintVersion() {
 	fmt.Printf("Current axion version %s\n", version)
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// braceRangeRe matches a numeric brace range body (e.g., "1..3" or "01..10")
+var braceRangeRe = regexp.MustCompile(`^(-?\d+)\.\.(-?\d+)$`)
+
+// maxBraceExpansion caps how many words a selector may expand to, so a typo
+// like {1..999999999} fails instead of exhausting memory
+const maxBraceExpansion = 10000
+
+// errBraceExpansion is returned for selectors expanding past maxBraceExpansion
+var errBraceExpansion = fmt.Errorf("expands to more than %d names", maxBraceExpansion)
+
+// expandSelector applies shell-style brace expansion to a comma-separated
+// selector (e.g., "worker{1..3},db{a,b}" -> worker1,worker2,worker3,dba,dbb)
+func expandSelector(selector string) ([]string, error) {
+	var expanded []string
+	for _, item := range splitTopLevel(selector) {
+		words, err := expandBraces(item)
+		if err != nil {
+			return nil, fmt.Errorf("malformed brace pattern '%s': %v", selector, err)
+		}
+		expanded = append(expanded, words...)
+		if len(expanded) > maxBraceExpansion {
+			return nil, fmt.Errorf("malformed brace pattern '%s': %v", selector, errBraceExpansion)
+		}
+	}
+	return expanded, nil
+}
+
+// splitTopLevel splits s on commas that are not nested inside braces
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, last := 0, 0
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// expandBraces expands every brace group in a single word, including nested
+// groups and numeric ranges
+func expandBraces(word string) ([]string, error) {
+	open := strings.IndexAny(word, "{}")
+	if open == -1 {
+		return []string{word}, nil
+	}
+	if word[open] == '}' {
+		return nil, fmt.Errorf("unmatched '}' at position %d", open+1)
+	}
+
+	// Find the brace closing the first group
+	closing := -1
+	depth := 0
+	for i := open; i < len(word) && closing == -1; i++ {
+		switch word[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				closing = i
+			}
+		}
+	}
+	if closing == -1 {
+		return nil, fmt.Errorf("unmatched '{' at position %d", open+1)
+	}
+
+	prefix, body, suffix := word[:open], word[open+1:closing], word[closing+1:]
+
+	alternatives, err := braceAlternatives(body)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes, err := expandBraces(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	for _, alt := range alternatives {
+		expandedAlt, err := expandBraces(alt)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range expandedAlt {
+			for _, s := range suffixes {
+				words = append(words, prefix+a+s)
+			}
+			if len(words) > maxBraceExpansion {
+				return nil, errBraceExpansion
+			}
+		}
+	}
+	return words, nil
+}
+
+// braceAlternatives returns the alternatives of a brace group body, either a
+// numeric range ("1..3") or a comma-separated list ("a,b")
+func braceAlternatives(body string) ([]string, error) {
+	if matches := braceRangeRe.FindStringSubmatch(body); matches != nil {
+		start, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid range start '%s': %v", matches[1], err)
+		}
+		end, err := strconv.Atoi(matches[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid range end '%s': %v", matches[2], err)
+		}
+
+		// Zero-padded bounds (e.g., {01..10}) keep their width
+		width := 0
+		if (len(matches[1]) > 1 && matches[1][0] == '0') || (len(matches[2]) > 1 && matches[2][0] == '0') {
+			width = max(len(matches[1]), len(matches[2]))
+		}
+
+		// Unsigned, so the difference can't overflow
+		if uint64(max(start, end))-uint64(min(start, end)) >= maxBraceExpansion {
+			return nil, errBraceExpansion
+		}
+
+		step := 1
+		if end < start {
+			step = -1
+		}
+		var alternatives []string
+		for n := start; ; n += step {
+			alternatives = append(alternatives, fmt.Sprintf("%0*d", width, n))
+			if n == end {
+				break
+			}
+		}
+		return alternatives, nil
+	}
+
+	alternatives := splitTopLevel(body)
+	if len(alternatives) < 2 {
+		return nil, fmt.Errorf("brace group '{%s}' needs a comma list or a start..end range", body)
+	}
+	return alternatives, nil
+}
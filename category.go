@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Categories of connection failures, stored in Result.Category for triage
+const (
+	categoryTimeout     = "timeout"     // No answer within the connect timeout
+	categoryRefused     = "refused"     // Nothing listening on the SSH port
+	categoryUnreachable = "unreachable" // No route to the host or its network
+	categoryDNS         = "dns"         // The host name didn't resolve
+	categoryAuth        = "auth"        // Connected, but the credentials were rejected
+	categoryHostKey     = "host_key"    // The host key didn't match known_hosts
+	categoryOther       = "other"       // Anything else (reset, handshake errors, ...)
+)
+
+// connectCategories lists the categories in the order reports show them
+var connectCategories = []string{categoryTimeout, categoryRefused, categoryUnreachable, categoryDNS, categoryAuth, categoryHostKey, categoryOther}
+
+// connectCategory classifies why a connection failed. Errors that lost their
+// type on the way (several addresses, -jump) are classified by message
+func connectCategory(err error) string {
+	var keyErr *hostKeyError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &keyErr):
+		return categoryHostKey
+	case errors.As(err, &dnsErr):
+		return categoryDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return categoryRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return categoryUnreachable
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return categoryTimeout
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "unable to authenticate"):
+		return categoryAuth
+	case strings.Contains(msg, "no such host"):
+		return categoryDNS
+	case strings.Contains(msg, "connection refused"):
+		return categoryRefused
+	case strings.Contains(msg, "no route to host"), strings.Contains(msg, "network is unreachable"):
+		return categoryUnreachable
+	case strings.Contains(msg, "i/o timeout"), strings.Contains(msg, "timed out"):
+		return categoryTimeout
+	}
+	return categoryOther
+}
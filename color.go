@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// ANSI color codes
+const (
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorReset = "\033[0m"
+)
+
+// colorize wraps s in the color when enabled
+func colorize(s, color string, enabled bool) string {
+	if !enabled {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// writeFailureTable writes an aligned table of the failed hosts with their exit
+// code and a one-line error, in red when color is enabled. Nothing is written
+// when every host succeeded
+func writeFailureTable(w io.Writer, results []Result, color bool) {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	failed := 0
+	for _, result := range results {
+		if result.Success || result.Skipped {
+			continue
+		}
+		failed++
+		code := "-"
+		if result.ExitCode >= 0 {
+			code = fmt.Sprint(result.ExitCode)
+		}
+		errText := ""
+		if result.Error != nil {
+			errText = firstLine(result.Error.Error())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.VPS.Name, result.VPS.IP, code, errText)
+	}
+	if failed == 0 {
+		return
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "FAILED HOSTS (%d of %d):\n", failed, len(results))
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		fmt.Fprintln(w, colorize(strings.TrimSuffix(line, "\n"), colorRed, color))
+	}
+}
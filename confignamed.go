@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseNamedConfig parses the config shape keyed by name:
+//
+//	worker1: {ip: 10.0.0.1, username: root, password: secret}
+//
+// ok is false when data isn't such a map (a list, or the credentials format),
+// so the caller can try the other shapes. Entries keep the file order and take
+// their name from the key; anchors and merge keys work as usual in YAML
+func parseNamedConfig(data []byte) (vpsList []VPS, ok bool, err error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil, false, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, false, nil
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "credentials", "defaults":
+			return nil, false, nil
+		}
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		var vps VPS
+		if err := value.Decode(&vps); err != nil {
+			return nil, true, fmt.Errorf("failed to parse config entry %s: %v", key.Value, err)
+		}
+		vps.Name = key.Value
+		vpsList = append(vpsList, vps)
+	}
+	return vpsList, true, nil
+}
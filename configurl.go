@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// configFetchTimeout bounds fetching the config from an HTTP(S) URL
+const configFetchTimeout = 30 * time.Second
+
+// isConfigURL reports whether the config location is an HTTP(S) URL
+func isConfigURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// parseConfigHeaders parses -config-header values of the form "Name: value"
+func parseConfigHeaders(values []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, value := range values {
+		name, v, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid config header '%s': expected 'Name: value'", value)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(v))
+	}
+	return headers, nil
+}
+
+// fetchConfig downloads the YAML config from an HTTP(S) URL
+func fetchConfig(url string, headers http.Header) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config URL %s: %v", url, err)
+	}
+	for name, values := range headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	client := &http.Client{Timeout: configFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config from %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch config from %s: server returned %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config from %s: %v", url, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// hostKey identifies a VPS in state files: its name, or its IP when unnamed
+func hostKey(vps VPS) string {
+	if vps.Name != "" {
+		return vps.Name
+	}
+	return vps.IP
+}
+
+// loadSuccessSet reads a -converge state file, one host key per line. A
+// missing file is an empty set so the first run targets every host
+func loadSuccessSet(path string) (map[string]bool, error) {
+	set := make(map[string]bool)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %v", path, err)
+	}
+	return set, nil
+}
+
+// selectPending keeps the hosts that are not in the success set, which covers
+// both hosts that failed before and hosts newly added to the config
+func selectPending(vpsList []VPS, succeeded map[string]bool) []VPS {
+	var pending []VPS
+	for _, vps := range vpsList {
+		if !succeeded[hostKey(vps)] {
+			pending = append(pending, vps)
+		}
+	}
+	return pending
+}
+
+// recordSuccesses appends the hosts that succeeded in this run to the state file
+func recordSuccesses(path string, results []Result, succeeded map[string]bool) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to update state file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	for _, result := range results {
+		key := hostKey(result.VPS)
+		if !result.Success || succeeded[key] {
+			continue
+		}
+		if _, err := fmt.Fprintln(f, key); err != nil {
+			return fmt.Errorf("failed to update state file %s: %v", path, err)
+		}
+		succeeded[key] = true
+	}
+	return nil
+}
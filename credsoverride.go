@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// credsOverride holds the fields a -creds-override entry may replace
+type credsOverride struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Secret   string `yaml:"secret"`
+	Port     int    `yaml:"port"`
+}
+
+// loadCredsOverrides reads a YAML map of VPS name to override credentials
+func loadCredsOverrides(path string) (map[string]credsOverride, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("credentials override file not found at %s", path)
+	}
+
+	var overrides map[string]credsOverride
+	if err := yaml.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials override file: %v", err)
+	}
+	for name, o := range overrides {
+		if o.Port < 0 || o.Port > 65535 {
+			return nil, fmt.Errorf("credentials override for %s: invalid port %d", name, o.Port)
+		}
+		if o.Password, err = resolvePassword(o.Password); err != nil {
+			return nil, fmt.Errorf("credentials override for %s: %v", name, err)
+		}
+		overrides[name] = o
+	}
+	return overrides, nil
+}
+
+// applyCredsOverrides replaces the credentials of matching VPS entries (by
+// name) with the non-empty override fields for this run only, and returns the
+// override names that matched no entry
+func applyCredsOverrides(vpsList []VPS, overrides map[string]credsOverride) []string {
+	used := make(map[string]bool)
+	for i := range vpsList {
+		o, ok := overrides[vpsList[i].Name]
+		if !ok {
+			continue
+		}
+		used[vpsList[i].Name] = true
+		if o.Username != "" {
+			vpsList[i].Username = o.Username
+		}
+		if o.Password != "" {
+			vpsList[i].Password = o.Password
+		}
+		if o.Secret != "" {
+			vpsList[i].Secret = o.Secret
+		}
+		if o.Port != 0 {
+			vpsList[i].Port = o.Port
+		}
+	}
+
+	var unknown []string
+	for name := range overrides {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
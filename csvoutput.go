@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// writeCSV writes results as CSV with a header row, one row per host. Only
+// the first line of stdout and of the error is kept, so every host stays on
+// a single spreadsheet row
+func writeCSV(w io.Writer, results []Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "ip", "success", "exit_code", "error", "stdout"})
+	for _, result := range results {
+		errText := ""
+		if result.Error != nil && !result.Success {
+			errText = firstLine(result.Error.Error())
+		}
+		cw.Write([]string{result.VPS.Name, result.VPS.IP, strconv.FormatBool(result.Success), strconv.Itoa(result.ExitCode), errText, firstLine(result.Stdout)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// dedupeKey is what -dedupe groups hosts by: their output, ignoring trailing
+// whitespace, and their exit code. Hosts without an exit status (couldn't
+// connect, skipped) are also told apart by why they failed
+type dedupeKey struct {
+	Stdout   string
+	ExitCode int
+	Failure  string // Connection failure category, or the error when there is none
+}
+
+// dedupeGroup is one distinct outcome and the hosts that produced it
+type dedupeGroup struct {
+	Key     dedupeKey
+	Results []Result
+}
+
+// dedupeResults groups results with identical output and exit code, most
+// common first; ties keep the order in which each outcome was first seen
+func dedupeResults(results []Result) []dedupeGroup {
+	index := make(map[dedupeKey]int)
+	var groups []dedupeGroup
+	for _, result := range results {
+		key := dedupeKey{Stdout: strings.TrimRight(result.Stdout, " \t\r\n"), ExitCode: result.ExitCode}
+		if result.ExitCode < 0 && result.Error != nil {
+			key.Failure = result.Category
+			if key.Failure == "" {
+				key.Failure = result.Error.Error()
+			}
+		}
+		i, seen := index[key]
+		if !seen {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, dedupeGroup{Key: key})
+		}
+		groups[i].Results = append(groups[i].Results, result)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Results) > len(groups[j].Results)
+	})
+	return groups
+}
+
+// writeDeduped prints each distinct output once, under a header with the
+// number of hosts that produced it and their names
+func writeDeduped(w io.Writer, results []Result) {
+	for _, group := range dedupeResults(results) {
+		names := make([]string, len(group.Results))
+		for j, result := range group.Results {
+			names[j] = result.VPS.Name
+			if names[j] == "" {
+				names[j] = result.VPS.IP
+			}
+		}
+		status := fmt.Sprintf("exit %d", group.Key.ExitCode)
+		if category := group.Results[0].Category; category != "" {
+			status = "failed (" + category + ")"
+		} else if group.Key.Failure != "" {
+			status = "failed"
+		} else if group.Key.ExitCode < 0 {
+			status = "no exit status"
+		}
+		fmt.Fprintf(w, "=== %d host(s), %s: %s ===\n", len(group.Results), status, strings.Join(names, ", "))
+		if group.Key.Stdout != "" {
+			fmt.Fprintln(w, group.Key.Stdout)
+		} else if group.Key.Failure == "" {
+			fmt.Fprintln(w, "(no output)")
+		}
+		// The errors of a category differ by address, show each one
+		if group.Key.Failure != "" {
+			for j, result := range group.Results {
+				fmt.Fprintf(w, "ERROR [%s]: %v\n", names[j], result.Error)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
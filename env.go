@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// envNamePattern matches the variable names -env accepts
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseEnv validates -env values of the form KEY=VALUE
+func parseEnv(values []string) ([]string, error) {
+	for _, kv := range values {
+		name, _, ok := strings.Cut(kv, "=")
+		if !ok || !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid -env '%s': expected KEY=VALUE with a shell variable name", kv)
+		}
+	}
+	return values, nil
+}
+
+// setSessionEnv sets env on the session with Setenv, which sshd only accepts
+// for names allowed by its AcceptEnv. It reports false if any was rejected
+func setSessionEnv(session *ssh.Session, env []string) bool {
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if err := session.Setenv(name, value); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// withEnv prefixes command with exports of env, for when Setenv can't be used
+func withEnv(command string, env []string) string {
+	var b strings.Builder
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		b.WriteString("export " + name + "=" + shellQuote(value) + "\n")
+	}
+	return b.String() + command
+}
+
+// How -env reached a host's command, recorded in Result.EnvVia
+const (
+	envViaSetenv = "setenv"
+	envViaExport = "export"
+)
+
+// writeEnvReport writes how -env was passed to each host
+func writeEnvReport(w io.Writer, results []Result) {
+	fmt.Fprintln(w, "Environment:")
+	for _, result := range results {
+		switch result.EnvVia {
+		case envViaSetenv:
+			fmt.Fprintf(w, "  [%s] set with Setenv\n", result.VPS.Name)
+		case envViaExport:
+			fmt.Fprintf(w, "  [%s] exported at the start of the command (Setenv rejected by sshd, or -sudo)\n", result.VPS.Name)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "context"
+
+// Executor runs a command on a single VPS. The SSH implementation is the
+// default; setting ExecOptions.Executor swaps it out, e.g. for a fake that
+// exercises selection, -parallel and exit code handling without servers.
+// Execute must honour ctx and be safe to call from several goroutines.
+// Only -c commands (single or repeated) go through it: -upload, -learn-hosts,
+// -use-agent, -forward and the checks made before a batch (-abort-if-unreachable,
+// -latency-aware) always connect over SSH
+type Executor interface {
+	Execute(ctx context.Context, vps VPS, command string) Result
+}
+
+// SSHExecutor is the default Executor: it connects to the VPS over SSH and
+// runs the command with Opts
+type SSHExecutor struct {
+	Opts ExecOptions
+}
+
+// Execute implements Executor
+func (e SSHExecutor) Execute(ctx context.Context, vps VPS, command string) Result {
+	return executeCommand(ctx, vps, command, e.Opts)
+}
+
+// executor returns opts.Executor, or the SSH executor when none is set
+func executor(opts ExecOptions) Executor {
+	if opts.Executor != nil {
+		return opts.Executor
+	}
+	return SSHExecutor{Opts: opts}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeExecutor answers every command without connecting: hosts listed in
+// codes exit with that status, the others succeed. With started and release
+// set, each host reports on started and then holds its slot until release is
+// closed
+type fakeExecutor struct {
+	codes   map[string]int
+	started chan<- string
+	release <-chan struct{}
+
+	mu      sync.Mutex
+	running int
+	peak    int
+	ran     []string
+}
+
+func (f *fakeExecutor) Execute(ctx context.Context, vps VPS, command string) Result {
+	f.mu.Lock()
+	f.running++
+	f.peak = max(f.peak, f.running)
+	f.ran = append(f.ran, vps.Name)
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+
+	if f.started != nil {
+		f.started <- vps.Name
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			return skipResult(Result{VPS: vps, ExitCode: -1}, ctx.Err())
+		}
+	}
+
+	code, failed := f.codes[vps.Name]
+	if !failed {
+		return Result{VPS: vps, Success: true, Stdout: command + "\n"}
+	}
+	result := Result{VPS: vps, ExitCode: code}
+	if code < 0 {
+		result.Error = fmt.Errorf("failed to connect: connection refused")
+	} else {
+		result.Error = fmt.Errorf("command exited with code %d", code)
+	}
+	return result
+}
+
+func testFleet(names ...string) []VPS {
+	vpsList := make([]VPS, len(names))
+	for i, name := range names {
+		vpsList[i] = VPS{Name: name, IP: "192.0.2.1", Username: "root", Password: "x"}
+	}
+	return vpsList
+}
+
+func TestRunCommandSelectedByIndices(t *testing.T) {
+	vpsList := testFleet("web1", "web2", "web3", "web10")
+
+	matched, err := findVPSByIndices(vpsList, []int{10, 2, 7})
+	if err == nil || err.Error() != "VPS numbers not found: [7]" {
+		t.Fatalf("findVPSByIndices error = %v, want the missing number 7", err)
+	}
+
+	fake := &fakeExecutor{codes: map[string]int{"web10": 3}}
+	results := runCommand(matched, "uptime", ExecOptions{Executor: fake})
+
+	var names []string
+	for _, result := range results {
+		names = append(names, result.VPS.Name)
+	}
+	if fmt.Sprint(names) != "[web10 web2]" {
+		t.Fatalf("results are for %v, want [web10 web2] in selection order", names)
+	}
+	if !results[1].Success || results[1].Stdout != "uptime\n" {
+		t.Errorf("web2 result = %+v, want the command's output", results[1])
+	}
+	if results[0].Success || results[0].ExitCode != 3 {
+		t.Errorf("web10 result = %+v, want exit code 3", results[0])
+	}
+	if len(fake.ran) != 2 {
+		t.Errorf("executor ran on %v, want only the 2 selected hosts", fake.ran)
+	}
+}
+
+func TestExitCodeAggregation(t *testing.T) {
+	vpsList := testFleet("web1", "web2", "web3", "web4")
+
+	tests := []struct {
+		name  string
+		codes map[string]int
+		worst bool
+		want  int
+	}{
+		{"all succeed", nil, false, 0},
+		{"any failure", map[string]int{"web2": 3, "web3": 7}, false, 1},
+		{"worst exit code", map[string]int{"web2": 3, "web3": 7}, true, 7},
+		{"connection failure", map[string]int{"web2": 3, "web4": -1}, true, exitCodeConnFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := runCommand(vpsList, "true", ExecOptions{Executor: &fakeExecutor{codes: tt.codes}})
+			if got := exitCode(results, tt.worst); got != tt.want {
+				t.Errorf("exitCode(worst=%v) = %d, want %d", tt.worst, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCommandParallelLimit(t *testing.T) {
+	vpsList := testFleet("web1", "web2", "web3", "web4", "web5")
+	started := make(chan string)
+	release := make(chan struct{})
+	fake := &fakeExecutor{started: started, release: release}
+
+	done := make(chan []Result)
+	go func() {
+		done <- runCommand(vpsList, "true", ExecOptions{Executor: fake, Parallel: 2})
+	}()
+
+	// Both slots taken, the hosts in them are held until release is closed
+	for range 2 {
+		<-started
+	}
+	select {
+	case name := <-started:
+		t.Fatalf("%s started while both -parallel slots were held", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	for range len(vpsList) - 2 {
+		<-started
+	}
+	results := <-done
+
+	if fake.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", fake.peak)
+	}
+	if code := exitCode(results, false); code != 0 {
+		t.Errorf("exitCode = %d, want 0", code)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// redacted replaces secrets in exported inventory unless -export-secrets is set
+const redacted = "REDACTED"
+
+// inventoryEntry is the exported representation of a VPS entry
+type inventoryEntry struct {
+	Name     string   `json:"name"`
+	IP       string   `json:"ip"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password,omitempty"`
+	Secret   string   `json:"secret,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// toInventory converts VPS entries to inventory entries, redacting secrets
+// unless includeSecrets is set
+func toInventory(vpsList []VPS, includeSecrets bool) []inventoryEntry {
+	entries := make([]inventoryEntry, len(vpsList))
+	for i, vps := range vpsList {
+		entries[i] = inventoryEntry{
+			Name:     vps.Name,
+			IP:       vps.IP,
+			Port:     vps.Port,
+			Username: vps.Username,
+			Password: redact(vps.Password, includeSecrets),
+			Secret:   redact(vps.Secret, includeSecrets),
+			Tags:     vps.Tags,
+		}
+	}
+	return entries
+}
+
+// redact hides a non-empty secret unless include is set
+func redact(secret string, include bool) string {
+	if include || secret == "" {
+		return secret
+	}
+	return redacted
+}
+
+// exportInventory writes the inventory to w as "csv" or "json"
+func exportInventory(w io.Writer, vpsList []VPS, format string, includeSecrets bool) error {
+	entries := toInventory(vpsList, includeSecrets)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"name", "ip", "port", "username", "password", "secret", "tags"})
+		for _, e := range entries {
+			cw.Write([]string{e.Name, e.IP, strconv.Itoa(e.Port), e.Username, e.Password, e.Secret, strings.Join(e.Tags, ";")})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unsupported export format '%s': expected csv or json", format)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// sshAddrs returns the SSH addresses of a VPS: its primary IP followed by any
+// additional "ips" entries (e.g., the IPv6 address of a dual-stack host), all
+// on the VPS port
+func sshAddrs(vps VPS) []string {
+	addrs := []string{sshAddr(vps)}
+	seen := map[string]bool{vps.IP: true}
+	for _, ip := range vps.IPs {
+		if ip == "" || seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		addrs = append(addrs, net.JoinHostPort(ip, sshPort(vps)))
+	}
+	return addrs
+}
+
+// dialFirst dials all addresses concurrently (Happy Eyeballs style) and
+// returns the first connection established, closing any that finish later
+func dialFirst(ctx context.Context, dialer *net.Dialer, addrs []string) (net.Conn, string, error) {
+	if len(addrs) == 1 {
+		conn, err := dialer.DialContext(ctx, "tcp", addrs[0])
+		return conn, addrs[0], err
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		addr string
+		err  error
+	}
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	results := make(chan dialResult, len(addrs))
+	for _, addr := range addrs {
+		go func(addr string) {
+			conn, err := dialer.DialContext(raceCtx, "tcp", addr)
+			results <- dialResult{conn, addr, err}
+		}(addr)
+	}
+
+	var errs []error
+	for pending := len(addrs); pending > 0; pending-- {
+		r := <-results
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", r.addr, r.err))
+			continue
+		}
+
+		// Winner found: stop the other attempts and close any late connection
+		cancel()
+		go func(remaining int) {
+			for ; remaining > 0; remaining-- {
+				if late := <-results; late.conn != nil {
+					late.conn.Close()
+				}
+			}
+		}(pending - 1)
+		return r.conn, r.addr, nil
+	}
+
+	cancel()
+	return nil, "", errors.Join(errs...)
+}
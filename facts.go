@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// factsScript prints the system facts gathered by -facts as key=value lines
+const factsScript = `echo "os=$( (. /etc/os-release && echo "$PRETTY_NAME") 2>/dev/null || uname -s)"
+echo "kernel=$(uname -r)"
+echo "cpus=$(nproc 2>/dev/null || getconf _NPROCESSORS_ONLN)"
+echo "mem_total_kb=$(awk '/^MemTotal:/ {print $2}' /proc/meminfo 2>/dev/null)"
+echo "disk_free_kb=$(df -Pk / | awk 'NR==2 {print $4}')"`
+
+// Facts holds the system facts parsed from factsScript
+type Facts struct {
+	OS       string `json:"os"`
+	Kernel   string `json:"kernel"`
+	CPUs     int    `json:"cpus"`
+	MemTotal uint64 `json:"mem_total_bytes"`
+	DiskFree uint64 `json:"disk_free_bytes"` // Free space on /
+}
+
+// parseFacts parses the key=value output of factsScript
+func parseFacts(output string) (*Facts, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	facts := &Facts{OS: values["os"], Kernel: values["kernel"]}
+	if facts.Kernel == "" {
+		return nil, fmt.Errorf("unexpected facts output: %q", output)
+	}
+
+	var err error
+	if v := values["cpus"]; v != "" {
+		if facts.CPUs, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid cpu count '%s'", v)
+		}
+	}
+	if v := values["mem_total_kb"]; v != "" {
+		kb, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory total '%s'", v)
+		}
+		facts.MemTotal = kb * 1024
+	}
+	if v := values["disk_free_kb"]; v != "" {
+		kb, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disk free '%s'", v)
+		}
+		facts.DiskFree = kb * 1024
+	}
+	return facts, nil
+}
+
+// applyFacts parses the facts of each successful result into Result.Facts,
+// marking results with unparseable output as failed
+func applyFacts(results []Result) {
+	for i := range results {
+		if !results[i].Success {
+			continue
+		}
+		facts, err := parseFacts(results[i].Stdout)
+		if err != nil {
+			results[i].Success = false
+			results[i].Error = err
+			continue
+		}
+		results[i].Facts = facts
+	}
+}
+
+// formatBytes renders a byte count with a binary unit (e.g., "7.7G")
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// writeFactsTable writes an aligned facts table for all results
+func writeFactsTable(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tIP\tOS\tKERNEL\tCPUS\tMEMORY\tDISK FREE")
+	for _, result := range results {
+		if result.Facts == nil {
+			fmt.Fprintf(tw, "%s\t%s\tERROR: %v\t\t\t\t\n", result.VPS.Name, result.VPS.IP, result.Error)
+			continue
+		}
+		f := result.Facts
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", result.VPS.Name, result.VPS.IP, f.OS, f.Kernel, f.CPUs, formatBytes(f.MemTotal), formatBytes(f.DiskFree))
+	}
+	tw.Flush()
+}
+
+// hostFacts is the JSON representation of one host's facts
+type hostFacts struct {
+	Name  string `json:"name"`
+	IP    string `json:"ip"`
+	Error string `json:"error,omitempty"`
+	*Facts
+}
+
+// writeFactsJSON writes the facts of all results as a JSON array
+func writeFactsJSON(w io.Writer, results []Result) error {
+	entries := make([]hostFacts, len(results))
+	for i, result := range results {
+		entries[i] = hostFacts{Name: result.VPS.Name, IP: result.VPS.IP, Facts: result.Facts}
+		if result.Facts == nil && result.Error != nil {
+			entries[i].Error = result.Error.Error()
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
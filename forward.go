@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// forwardSpec is a -forward LOCAL:REMOTE tunnel
+type forwardSpec struct {
+	Local  string // Local listen address
+	Remote string // Address dialed from the VPS
+}
+
+// parseForward parses a -forward spec: "LPORT:RPORT" forwards to a port on
+// the VPS's localhost, "LPORT:HOST:RPORT" to an address reachable from it.
+// The local port only listens on 127.0.0.1
+func parseForward(spec string) (*forwardSpec, error) {
+	localPort, remote, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid -forward '%s': expected LOCAL:REMOTE (e.g., 8080:5432 or 8080:db.internal:5432)", spec)
+	}
+	if !strings.Contains(remote, ":") {
+		remote = "localhost:" + remote
+	}
+	host, remotePort, err := net.SplitHostPort(remote)
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("invalid -forward '%s': bad remote address '%s'", spec, remote)
+	}
+	for _, port := range []string{localPort, remotePort} {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid -forward '%s': bad port '%s'", spec, port)
+		}
+	}
+	return &forwardSpec{Local: net.JoinHostPort("127.0.0.1", localPort), Remote: remote}, nil
+}
+
+// runForward connects to vps and forwards every connection made to the
+// local address to the remote address through it, until ctx is done or the
+// SSH connection drops
+func runForward(ctx context.Context, vps VPS, spec *forwardSpec, opts ExecOptions) error {
+	var result Result
+	client, err := connectAttempt(ctx, vps, opts, &result)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return connectError(err)
+	}
+	defer client.Close()
+
+	listener, err := net.Listen("tcp", spec.Local)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", spec.Local, err)
+	}
+	defer listener.Close()
+
+	// Stop accepting once interrupted or when the VPS goes away
+	dropped := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(dropped)
+		listener.Close()
+	}()
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+
+	fmt.Printf("Forwarding %s -> %s via %s (%s), press Ctrl-C to stop\n", listener.Addr(), spec.Remote, vps.Name, result.Addr)
+
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-dropped:
+				return fmt.Errorf("connection to %s closed", vps.Name)
+			default:
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept on %s: %v", spec.Local, err)
+		}
+
+		// Closing the client on return tears down the open tunnels
+		go func() {
+			defer local.Close()
+			remote, err := client.Dial("tcp", spec.Remote)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s could not reach %s: %v\n", vps.Name, spec.Remote, err)
+				return
+			}
+			defer remote.Close()
+			pipe(local, remote)
+		}()
+	}
+}
+
+// pipe copies between a and b in both directions until either side is done
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
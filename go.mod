@@ -3,12 +3,13 @@ module github.com/mrmahile/axion
 go 1.25.4
 
 require (
+	github.com/kevinburke/ssh_config v1.6.0
+	github.com/pkg/sftp v1.13.10
 	golang.org/x/crypto v0.46.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/kr/fs v0.1.0 // indirect
-	github.com/pkg/sftp v1.13.10 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 )
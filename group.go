@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// noTagGroup collects hosts that don't carry the grouping tag
+const noTagGroup = "(none)"
+
+// tagValue returns the value of a "key=value" or "key:value" tag on a VPS.
+// Plain tags have no value and never match
+func tagValue(vps VPS, key string) (string, bool) {
+	for _, tag := range vps.Tags {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			k, v, ok = strings.Cut(tag, ":")
+		}
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v), true
+		}
+	}
+	return "", false
+}
+
+// resultGroup is a set of results sharing the same tag value
+type resultGroup struct {
+	Value   string
+	Results []Result
+}
+
+// groupResultsByTag buckets results by the value of the tag key, keeping the
+// order in which values first appear and putting untagged hosts last
+func groupResultsByTag(results []Result, key string) []resultGroup {
+	var groups []resultGroup
+	index := make(map[string]int)
+	var untagged []Result
+
+	for _, result := range results {
+		value, ok := tagValue(result.VPS, key)
+		if !ok {
+			untagged = append(untagged, result)
+			continue
+		}
+		i, seen := index[value]
+		if !seen {
+			i = len(groups)
+			index[value] = i
+			groups = append(groups, resultGroup{Value: value})
+		}
+		groups[i].Results = append(groups[i].Results, result)
+	}
+
+	if len(untagged) > 0 {
+		groups = append(groups, resultGroup{Value: noTagGroup, Results: untagged})
+	}
+	return groups
+}
+
+// printGroupedResults prints results bucketed by tag with a header per group
+func printGroupedResults(results []Result, key string, color bool) {
+	for _, group := range groupResultsByTag(results, key) {
+		fmt.Printf("=== %s: %s (%d) ===\n\n", key, group.Value, len(group.Results))
+		for _, result := range group.Results {
+			printResult(result, color)
+			fmt.Println()
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// copyGunzip decompresses gzip data from r into w. When r doesn't hold valid
+// gzip data the rest of r is drained so the remote command never blocks on a
+// full pipe, and an error is returned
+func copyGunzip(w io.Writer, r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err == io.EOF {
+		return nil // No output at all
+	}
+	if err != nil {
+		io.Copy(io.Discard, r)
+		return fmt.Errorf("stdout is not gzip data: %v", err)
+	}
+	defer zr.Close()
+
+	if _, err := io.Copy(w, zr); err != nil {
+		io.Copy(io.Discard, r)
+		return fmt.Errorf("failed to decompress stdout: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultKnownHosts returns ~/.ssh/known_hosts, the default for -known-hosts
+func defaultKnownHosts() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// hostKeyError is a host key that failed verification against known_hosts
+type hostKeyError struct {
+	msg string
+}
+
+func (e *hostKeyError) Error() string {
+	return e.msg
+}
+
+// verifyHostKeys returns a host key callback checking keys against the
+// known_hosts file at path, with errors that tell a changed key (possible
+// man-in-the-middle) from a host that was never recorded
+func verifyHostKeys(path string) (ssh.HostKeyCallback, error) {
+	check, err := knownhosts.New(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("known_hosts file %s not found: record the fleet's keys with -learn-hosts %s, or pass -insecure to skip verification", path, path)
+		}
+		return nil, fmt.Errorf("failed to load known_hosts file %s: %v", path, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) > 0 {
+				return &hostKeyError{fmt.Sprintf("host key mismatch for %s: got %s %s, which does not match the key recorded at %s:%d (possible man-in-the-middle attack, or the host was reinstalled)",
+					hostname, key.Type(), ssh.FingerprintSHA256(key), keyErr.Want[0].Filename, keyErr.Want[0].Line)}
+			}
+			return &hostKeyError{fmt.Sprintf("host key for %s is not in %s (add it with -learn-hosts)", hostname, path)}
+		}
+		return err
+	}, nil
+}
+
+// connectError describes a failed connection. Host key verification failures
+// are returned as is so they aren't mistaken for network problems
+func connectError(err error) error {
+	var keyErr *hostKeyError
+	if errors.As(err, &keyErr) {
+		return keyErr
+	}
+	return fmt.Errorf("failed to connect: %v", err)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// hostOptionKeys are the per-host "options" keys understood by axion
+var hostOptionKeys = map[string]string{
+	"ciphers":            "comma-separated cipher list",
+	"kex":                "comma-separated key exchange list",
+	"macs":               "comma-separated MAC list",
+	"hostkey_algorithms": "comma-separated host key algorithm list",
+	"connect_timeout":    "duration, e.g. 10s",
+	"keepalive":          "duration between keepalive requests, e.g. 30s",
+}
+
+// validateHostOptions checks that every per-host option is known and parses
+func validateHostOptions(options map[string]string) error {
+	for key, value := range options {
+		if key == "compression" {
+			return fmt.Errorf("option compression is not supported by the SSH client")
+		}
+		if _, ok := hostOptionKeys[key]; !ok {
+			return fmt.Errorf("unknown option %s (supported: %s)", key, supportedHostOptions())
+		}
+		if key == "connect_timeout" || key == "keepalive" {
+			if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+				return fmt.Errorf("option %s: invalid duration '%s'", key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// supportedHostOptions lists hostOptionKeys with their descriptions, sorted
+// by key
+func supportedHostOptions() string {
+	keys := slices.Sorted(maps.Keys(hostOptionKeys))
+	for i, key := range keys {
+		keys[i] = key + " (" + hostOptionKeys[key] + ")"
+	}
+	return strings.Join(keys, ", ")
+}
+
+// splitList splits a comma-separated option value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// applyHostOptions applies the per-host options of a VPS to its client config.
+// Options were validated by loadConfig
+func applyHostOptions(config *ssh.ClientConfig, options map[string]string) {
+	for key, value := range options {
+		switch key {
+		case "ciphers":
+			config.Ciphers = splitList(value)
+		case "kex":
+			config.KeyExchanges = splitList(value)
+		case "macs":
+			config.MACs = splitList(value)
+		case "hostkey_algorithms":
+			config.HostKeyAlgorithms = splitList(value)
+		case "connect_timeout":
+			config.Timeout, _ = time.ParseDuration(value)
+		}
+	}
+}
+
+// hostKeepalive returns the keepalive interval of a host: its per-host
+// keepalive option, falling back to -keepalive (0 = none)
+func hostKeepalive(vps VPS, opts ExecOptions) time.Duration {
+	if d, err := time.ParseDuration(vps.Options["keepalive"]); err == nil {
+		return d
+	}
+	return opts.Keepalive
+}
+
+// startKeepalive sends keepalive@openssh.com requests every interval until
+// the client connection is closed
+func startKeepalive(client *ssh.Client, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closed)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case <-ticker.C:
+				if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// loadHostsFile reads a -hosts-file: one host per line, either
+// "name ip username password" or just "ip", which is named after its address
+// and takes username, password and port from the config defaults. Blank
+// lines and lines starting with # are ignored
+func loadHostsFile(path string, defaults ConfigDefaults, sshConfig *ssh_config.Config) ([]VPS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("hosts file not found at %s", path)
+	}
+	defer f.Close()
+
+	var hosts []VPS
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var vps VPS
+		switch fields := strings.Fields(line); len(fields) {
+		case 1:
+			vps = VPS{Name: fields[0], IP: fields[0]}
+		case 4:
+			vps = VPS{Name: fields[0], IP: fields[1], Username: fields[2], Password: fields[3]}
+		default:
+			return nil, fmt.Errorf("hosts file line %d: expected 'name ip username password' or 'ip', got %d fields", lineNum, len(fields))
+		}
+		if seen[vps.Name] {
+			return nil, fmt.Errorf("hosts file line %d: duplicate host %s", lineNum, vps.Name)
+		}
+		seen[vps.Name] = true
+		if err := prepareEntry(&vps, defaults, sshConfig); err != nil {
+			return nil, fmt.Errorf("hosts file line %d: %v", lineNum, err)
+		}
+		hosts = append(hosts, vps)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hosts file: %v", err)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("hosts file %s contains no hosts", path)
+	}
+	return hosts, nil
+}
+
+// mergeHosts adds hosts to vpsList for this run. A host named like a config
+// entry replaces that entry in place, others are appended in file order
+func mergeHosts(vpsList, hosts []VPS) []VPS {
+	byName := make(map[string]int)
+	for i, vps := range vpsList {
+		if _, seen := byName[vps.Name]; !seen && vps.Name != "" {
+			byName[vps.Name] = i
+		}
+	}
+	for _, host := range hosts {
+		if i, ok := byName[host.Name]; ok {
+			vpsList[i] = host
+			continue
+		}
+		byName[host.Name] = len(vpsList)
+		vpsList = append(vpsList, host)
+	}
+	return vpsList
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+)
+
+// htmlReportTemplate renders a self-contained results page. html/template
+// escapes all command output
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>axion report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+code, pre { font-family: Menlo, Consolas, monospace; font-size: 0.9em; }
+pre { background: #f6f8fa; padding: 0.6em; overflow-x: auto; white-space: pre-wrap; margin: 0.3em 0; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.status { font-weight: bold; border-radius: 3px; padding: 0.1em 0.5em; }
+.success { background: #dcfce7; color: #166534; }
+.failed { background: #fee2e2; color: #991b1b; }
+.skipped { background: #fef9c3; color: #854d0e; }
+.summary span { margin-right: 1.5em; }
+</style>
+</head>
+<body>
+<h1>axion report</h1>
+<p>Command: <code>{{.Command}}</code><br>Generated {{.Generated}}</p>
+<p class="summary">
+<span>Total: {{.Summary.Total}}</span>
+<span class="status success">Succeeded: {{.Summary.Succeeded}}</span>
+<span class="status failed">Failed: {{.Summary.Failed}}</span>
+<span class="status skipped">Skipped: {{.Summary.Skipped}}</span>
+</p>
+<table>
+<tr><th>Host</th><th>IP</th><th>Status</th><th>Exit</th><th>Duration</th><th>Output</th></tr>
+{{range .Rows}}<tr>
+<td>{{.Name}}</td>
+<td>{{.IP}}</td>
+<td><span class="status {{.Class}}">{{.Status}}</span></td>
+<td>{{if ge .ExitCode 0}}{{.ExitCode}}{{else}}-{{end}}</td>
+<td>{{.Duration}}</td>
+<td>
+{{if .Error}}<div>{{.Error}}</div>{{end}}
+{{if .Stdout}}<details{{if not .Stderr}} open{{end}}><summary>stdout</summary><pre>{{.Stdout}}</pre></details>{{end}}
+{{if .Stderr}}<details><summary>stderr</summary><pre>{{.Stderr}}</pre></details>{{end}}
+</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// htmlReportRow is one host in the HTML report
+type htmlReportRow struct {
+	Name     string
+	IP       string
+	Status   string
+	Class    string
+	ExitCode int
+	Duration string
+	Stdout   string
+	Stderr   string
+	Error    string
+}
+
+// writeHTMLReport writes the results of command as a styled HTML page to path
+func writeHTMLReport(path, command string, results []Result) error {
+	data := struct {
+		Command   string
+		Generated string
+		Summary   runSummary
+		Rows      []htmlReportRow
+	}{
+		Command:   command,
+		Generated: time.Now().Format("2006-01-02 15:04:05 MST"),
+		Summary:   summarize(results),
+	}
+
+	for _, result := range results {
+		row := htmlReportRow{
+			Name:     result.VPS.Name,
+			IP:       result.VPS.IP,
+			Status:   "SUCCESS",
+			Class:    "success",
+			ExitCode: result.ExitCode,
+			Stdout:   result.Stdout,
+			Stderr:   result.Stderr,
+		}
+		if result.Skipped {
+			row.Status, row.Class = "SKIPPED", "skipped"
+		} else if !result.Success {
+			row.Status, row.Class = "FAILED", "failed"
+		}
+		if result.Duration > 0 {
+			row.Duration = result.Duration.Round(time.Millisecond).String()
+		}
+		if result.Error != nil && !result.Success {
+			row.Error = result.Error.Error()
+		}
+		data.Rows = append(data.Rows, row)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write HTML report: %v", err)
+	}
+	defer f.Close()
+
+	if err := htmlReportTemplate.Execute(f, data); err != nil {
+		return fmt.Errorf("failed to write HTML report: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonResult is the -json representation of a host's result
+type jsonResult struct {
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	Success   bool   `json:"success"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Error     string `json:"error,omitempty"`
+	ExitCode  int    `json:"exit_code"`
+	MatchedBy string `json:"matched_by,omitempty"`
+
+	SudoAuthFailed bool `json:"sudo_auth_failed,omitempty"`
+	FailedCommand  int  `json:"failed_command,omitempty"`
+
+	Category string `json:"category,omitempty"`
+}
+
+func toJSONResult(result Result) jsonResult {
+	r := jsonResult{
+		Name:      result.VPS.Name,
+		IP:        result.VPS.IP,
+		Success:   result.Success,
+		Skipped:   result.Skipped,
+		Stdout:    result.Stdout,
+		Stderr:    result.Stderr,
+		ExitCode:  result.ExitCode,
+		MatchedBy: result.MatchedBy,
+
+		SudoAuthFailed: result.SudoAuthFailed,
+		FailedCommand:  result.FailedCommand,
+
+		Category: result.Category,
+	}
+	if result.Error != nil && !result.Success {
+		r.Error = result.Error.Error()
+	}
+	return r
+}
+
+// writeJSONLine writes a result as one line of JSON (NDJSON)
+func writeJSONLine(w io.Writer, result Result) error {
+	return json.NewEncoder(w).Encode(toJSONResult(result))
+}
+
+// writeJSONArray writes all results as a single indented JSON array
+func writeJSONArray(w io.Writer, results []Result) error {
+	out := make([]jsonResult, len(results))
+	for i, result := range results {
+		out[i] = toJSONResult(result)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
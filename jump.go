@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// jumpHost is a bastion every VPS connection is tunnelled through. The
+// bastion connection is made once, on first use, and shared by all hosts
+type jumpHost struct {
+	vps VPS
+
+	once   sync.Once
+	client *ssh.Client
+	err    error
+}
+
+// newJumpHost resolves a -jump spec of the form [user@]host[:port]. The host
+// must be a config entry (by name or IP), which provides the credentials;
+// user and port, when given, override the entry's
+func newJumpHost(spec string, vpsList []VPS) (*jumpHost, error) {
+	user, hostPort, hasUser := strings.Cut(spec, "@")
+	if !hasUser {
+		user, hostPort = "", spec
+	}
+	if hasUser && user == "" {
+		return nil, fmt.Errorf("invalid jump host '%s': expected [user@]host[:port]", spec)
+	}
+
+	host, port := hostPort, 0
+	if h, p, err := net.SplitHostPort(hostPort); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid jump host '%s': bad port '%s'", spec, p)
+		}
+		host, port = h, n
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid jump host '%s': expected [user@]host[:port]", spec)
+	}
+
+	for _, vps := range vpsList {
+		if vps.Name != host && vps.IP != host {
+			continue
+		}
+		if user != "" {
+			vps.Username = user
+		}
+		if port != 0 {
+			vps.Port = port
+		}
+		vps.IPs = nil
+		return &jumpHost{vps: vps}, nil
+	}
+	return nil, fmt.Errorf("jump host %s not found in config: add it as an entry to provide its credentials", host)
+}
+
+// dial opens a connection to addr through the bastion, connecting to the
+// bastion itself first if this is the first use
+func (j *jumpHost) dial(ctx context.Context, addr string, opts ExecOptions) (net.Conn, error) {
+	j.once.Do(func() {
+		// Not bound to the first host's context, every host shares it
+		bastionOpts := opts
+		bastionOpts.Jump = nil
+		parent := context.Background()
+		if opts.Context != nil {
+			parent = opts.Context
+		}
+		var err error
+		j.client, _, err = connect(parent, j.vps, bastionOpts)
+		if err != nil {
+			j.err = fmt.Errorf("jump host %s: %v", sshAddr(j.vps), err)
+		}
+	})
+	if j.err != nil {
+		return nil, j.err
+	}
+	return j.client.DialContext(ctx, "tcp", addr)
+}
+
+// dialFirst dials addrs one after another through the bastion and returns
+// the first connection established
+func (j *jumpHost) dialFirst(ctx context.Context, addrs []string, opts ExecOptions) (net.Conn, string, error) {
+	var errs []string
+	for _, addr := range addrs {
+		conn, err := j.dial(ctx, addr, opts)
+		if err == nil {
+			return conn, addr, nil
+		}
+		if j.err != nil || ctx.Err() != nil {
+			return nil, "", err
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
+	}
+	return nil, "", fmt.Errorf("via jump host: %s", strings.Join(errs, "; "))
+}
+
+// close closes the bastion connection, if one was made
+func (j *jumpHost) close() {
+	if j.client != nil {
+		j.client.Close()
+	}
+}
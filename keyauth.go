@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// readSecret returns the private key held in a VPS secret: either the PEM
+// content itself or the path of a key file ("~/" expands to the home dir)
+func readSecret(secret string) ([]byte, error) {
+	if strings.Contains(secret, "-----BEGIN ") {
+		return []byte(secret), nil
+	}
+
+	path := secret
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand %s: %v", secret, err)
+		}
+		path = filepath.Join(home, rest)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+	return data, nil
+}
+
+// parseSecretKey parses the private key of a VPS. An encrypted key is
+// decrypted with the VPS password as passphrase; encrypted reports whether
+// that was needed
+func parseSecretKey(vps VPS) (signer ssh.Signer, encrypted bool, err error) {
+	data, err := readSecret(vps.Secret)
+	if err != nil {
+		return nil, false, err
+	}
+
+	signer, err = ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if vps.Password == "" {
+			return nil, true, fmt.Errorf("private key is encrypted and no password is set to use as passphrase")
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(vps.Password))
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to decrypt private key: %v", err)
+		}
+		return signer, true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	return signer, false, nil
+}
+
+// authMethods returns how to authenticate to a VPS: its private key when a
+// secret is set, otherwise its password. The password is also offered after
+// an unencrypted key, but never when it serves as the key's passphrase
+func authMethods(vps VPS) ([]ssh.AuthMethod, error) {
+	if vps.Secret == "" {
+		return []ssh.AuthMethod{ssh.Password(vps.Password)}, nil
+	}
+
+	signer, encrypted, err := parseSecretKey(vps)
+	if err != nil {
+		return nil, err
+	}
+	methods := []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	if !encrypted && vps.Password != "" {
+		methods = append(methods, ssh.Password(vps.Password))
+	}
+	return methods, nil
+}
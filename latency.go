@@ -0,0 +1,41 @@
+package main
+
+import (
+	"maps"
+	"time"
+)
+
+// latencyTimeout scales a measured round trip time into a connect timeout,
+// clamped to [minTimeout, maxTimeout]. Unmeasured hosts (rtt 0) get maxTimeout
+func latencyTimeout(rtt time.Duration, factor float64, minTimeout, maxTimeout time.Duration) time.Duration {
+	if rtt <= 0 {
+		return maxTimeout
+	}
+	timeout := time.Duration(float64(rtt) * factor)
+	if timeout < minTimeout {
+		return minTimeout
+	}
+	if timeout > maxTimeout {
+		return maxTimeout
+	}
+	return timeout
+}
+
+// applyLatencyTimeouts probes every VPS once and sets its connect_timeout
+// option from the measured latency. An explicit connect_timeout in the
+// config is kept
+func applyLatencyTimeouts(vpsList []VPS, factor float64, minTimeout, maxTimeout time.Duration, opts ExecOptions) {
+	rtts, _ := probeSSHPorts(vpsList, maxTimeout, opts)
+	for i := range vpsList {
+		if _, ok := vpsList[i].Options["connect_timeout"]; ok {
+			continue
+		}
+		// Copy before changing: entries share the map with the loaded config
+		options := maps.Clone(vpsList[i].Options)
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options["connect_timeout"] = latencyTimeout(rtts[i], factor, minTimeout, maxTimeout).String()
+		vpsList[i].Options = options
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// learnHostKeyTask returns a hostTask that connects to each VPS without host
+// key verification and captures the presented host key as a known_hosts line
+// in Result.Stdout. The line lists every address of the host, not only the one
+// that answered first, so later connections to the others verify too.
+// Authentication failures don't matter, the key is exchanged before
+// authentication
+func learnHostKeyTask(opts ExecOptions) hostTask {
+	return func(ctx context.Context, vps VPS) Result {
+		result := Result{
+			VPS:      vps,
+			ExitCode: -1,
+		}
+
+		var hostKey ssh.PublicKey
+		config, err := newClientConfig(vps, opts)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return nil
+		}
+
+		client, addr, err := dialSSH(ctx, sshAddrs(vps), config, opts)
+		if client != nil {
+			client.Close()
+		}
+		if hostKey == nil {
+			if ctx.Err() != nil {
+				return skipResult(result, ctx.Err())
+			}
+			result.Error = fmt.Errorf("no host key received: %v", err)
+			return result
+		}
+
+		result.Addr = addr
+		result.Stdout = knownhosts.Line(normalizeAddrs(sshAddrs(vps)), hostKey)
+		if err != nil {
+			// Key recorded, but note that the credentials didn't work
+			result.Stderr = fmt.Sprintf("authentication failed: %v", err)
+		}
+		result.Success = true
+		result.ExitCode = 0
+		return result
+	}
+}
+
+// normalizeAddrs returns addrs as known_hosts host patterns
+func normalizeAddrs(addrs []string) []string {
+	hosts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		hosts[i] = knownhosts.Normalize(addr)
+	}
+	return hosts
+}
+
+// knownAddr is an address in host:port form, passed to a known_hosts
+// callback as the remote address of a connection that isn't made
+type knownAddr string
+
+func (a knownAddr) Network() string { return "tcp" }
+func (a knownAddr) String() string  { return string(a) }
+
+// loadRecordedKeys returns a callback checking keys against path, or nil when
+// the file doesn't exist yet
+func loadRecordedKeys(path string) (ssh.HostKeyCallback, error) {
+	check, err := knownhosts.New(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts file %s: %v", path, err)
+	}
+	return check, nil
+}
+
+// learnedKey returns the key of a learned known_hosts line
+func learnedKey(line string) (ssh.PublicKey, error) {
+	_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+	return key, err
+}
+
+// checkLearnedKeys fails the hosts whose learned key differs from the one
+// path already records for one of their addresses, rather than adding a
+// second, conflicting line
+func checkLearnedKeys(path string, results []Result) error {
+	check, err := loadRecordedKeys(path)
+	if err != nil || check == nil {
+		return err
+	}
+
+	for i, result := range results {
+		if !result.Success {
+			continue
+		}
+		key, err := learnedKey(result.Stdout)
+		if err != nil {
+			continue
+		}
+		for _, addr := range sshAddrs(result.VPS) {
+			var keyErr *knownhosts.KeyError
+			if errors.As(check(addr, knownAddr(addr), key), &keyErr) && len(keyErr.Want) > 0 {
+				results[i].Success = false
+				results[i].ExitCode = -1
+				results[i].Error = fmt.Errorf("host key mismatch for %s: got %s %s, but %s:%d records a different key (possible man-in-the-middle attack, or the host was reinstalled; remove the old line to record the new key)",
+					addr, key.Type(), ssh.FingerprintSHA256(key), keyErr.Want[0].Filename, keyErr.Want[0].Line)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// writeLearnedHosts appends the learned keys to path for the addresses it
+// doesn't know yet, and returns how many lines were added
+func writeLearnedHosts(path string, results []Result) (int, error) {
+	check, err := loadRecordedKeys(path)
+	if err != nil {
+		return 0, err
+	}
+
+	existing := make(map[string]bool)
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			existing[strings.TrimSpace(scanner.Text())] = true
+		}
+		f.Close()
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	added := 0
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		key, err := learnedKey(result.Stdout)
+		if err != nil {
+			continue
+		}
+
+		var addrs []string
+		for _, addr := range sshAddrs(result.VPS) {
+			if check == nil || check(addr, knownAddr(addr), key) != nil {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			continue // Every address is already recorded with this key
+		}
+
+		line := knownhosts.Line(normalizeAddrs(addrs), key)
+		if existing[line] {
+			continue
+		}
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			return added, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		existing[line] = true
+		added++
+	}
+	return added, nil
+}
+
+// writeLearnReport lists the recorded key (type and fingerprint) per host
+// and the hosts whose key couldn't be recorded
+func writeLearnReport(w io.Writer, results []Result) {
+	for _, result := range results {
+		if !result.Success {
+			fmt.Fprintf(w, "[%s] NOT RECORDED: %v\n", result.VPS.Name, result.Error)
+			continue
+		}
+
+		_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(result.Stdout))
+		if err != nil {
+			fmt.Fprintf(w, "[%s] recorded %s\n", result.VPS.Name, result.Addr)
+			continue
+		}
+		fmt.Fprintf(w, "[%s] recorded %s %s %s\n", result.VPS.Name, result.Addr, key.Type(), ssh.FingerprintSHA256(key))
+		if result.Stderr != "" {
+			fmt.Fprintf(w, "  note: %s\n", result.Stderr)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// maskReplacement replaces every -mask match in captured output
+const maskReplacement = "***"
+
+// maskOutput replaces all matches of masks in s with maskReplacement
+func maskOutput(s string, masks []*regexp.Regexp) string {
+	for _, re := range masks {
+		s = re.ReplaceAllString(s, maskReplacement)
+	}
+	return s
+}
+
+// maskWriter masks output line by line before passing it on, so streamed
+// sinks (e.g., -outdir files) never contain the unmasked text
+type maskWriter struct {
+	w     io.Writer
+	masks []*regexp.Regexp
+	buf   []byte
+}
+
+// newMaskWriter wraps w, returning w unchanged when there is nothing to mask
+func newMaskWriter(w io.Writer, masks []*regexp.Regexp) io.Writer {
+	if len(masks) == 0 {
+		return w
+	}
+	return &maskWriter{w: w, masks: masks}
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	for {
+		i := bytes.IndexByte(m.buf, '\n')
+		if i == -1 {
+			break
+		}
+		line := maskOutput(string(m.buf[:i+1]), m.masks)
+		m.buf = m.buf[i+1:]
+		if _, err := io.WriteString(m.w, line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes any trailing partial line
+func (m *maskWriter) Flush() error {
+	if len(m.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(m.w, maskOutput(string(m.buf), m.masks))
+	m.buf = nil
+	return err
+}
+
+// flushWriter flushes w if it buffers output (e.g., a maskWriter)
+func flushWriter(w io.Writer) {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
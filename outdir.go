@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputFileBase returns the file name prefix used for a VPS in -outdir,
+// falling back to the IP for unnamed entries
+func outputFileBase(vps VPS) string {
+	base := vps.Name
+	if base == "" {
+		base = vps.IP
+	}
+	// Keep the files inside the output directory
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(base)
+}
+
+// createOutputFiles creates (or truncates) <name>.stdout and <name>.stderr in dir
+func createOutputFiles(dir string, vps VPS) (stdout, stderr *os.File, err error) {
+	base := filepath.Join(dir, outputFileBase(vps))
+
+	stdout, err = os.Create(base + ".stdout")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stderr, err = os.Create(base + ".stderr")
+	if err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+
+	return stdout, stderr, nil
+}
+
+// truncateUnrunOutput empties the output files of hosts that never got a
+// working connection in this run, so files left by an earlier run aren't
+// mistaken for this run's output
+func truncateUnrunOutput(dir string, results []Result) error {
+	for _, result := range results {
+		attempts := result.Attempts
+		connected := len(attempts) > 0 && attempts[len(attempts)-1].Error == nil
+		if connected || result.Reused {
+			continue
+		}
+		stdout, stderr, err := createOutputFiles(dir, result.VPS)
+		if err != nil {
+			return fmt.Errorf("failed to truncate output files: %v", err)
+		}
+		stdout.Close()
+		stderr.Close()
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// topOutputHosts is how many of the largest producers the output report lists
+const topOutputHosts = 5
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// outputBytes returns the bytes a host sent, including its -on-failure cleanup
+func outputBytes(result Result) int64 {
+	n := result.StdoutBytes + result.StderrBytes
+	if result.Cleanup != nil {
+		n += outputBytes(*result.Cleanup)
+	}
+	return n
+}
+
+// hostOutput is one entry of the largest producers list
+type hostOutput struct {
+	Host  string `json:"host"`
+	Bytes int64  `json:"bytes"`
+}
+
+// largestOutputs returns the total output of a batch and up to n hosts that
+// produced the most, largest first
+func largestOutputs(results []Result, n int) (int64, []hostOutput) {
+	var total int64
+	var hosts []hostOutput
+	for _, result := range results {
+		size := outputBytes(result)
+		total += size
+		if size > 0 {
+			hosts = append(hosts, hostOutput{Host: hostKey(result.VPS), Bytes: size})
+		}
+	}
+	sort.SliceStable(hosts, func(a, b int) bool {
+		return hosts[a].Bytes > hosts[b].Bytes
+	})
+	if len(hosts) > n {
+		hosts = hosts[:n]
+	}
+	return total, hosts
+}
+
+// writeOutputReport writes the total output size and the largest producers
+func writeOutputReport(w io.Writer, results []Result) {
+	total, hosts := largestOutputs(results, topOutputHosts)
+	fmt.Fprintf(w, "Output: %s total\n", formatBytes(uint64(total)))
+	for _, host := range hosts {
+		fmt.Fprintf(w, "  %s: %s\n", host.Host, formatBytes(uint64(host.Bytes)))
+	}
+}
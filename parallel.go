@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultParallel is the concurrency used when -parallel isn't given, so
+	// large ranges don't open hundreds of SSH connections at once
+	defaultParallel = 20
+	// maxAutoParallel caps the concurrency chosen by -parallel auto
+	maxAutoParallel = 100
+	// fdsPerHost is a conservative estimate of file descriptors one host uses
+	// (SSH socket plus -outdir files and slack)
+	fdsPerHost = 4
+	// reservedFDs are left for stdio, config, logs and the Go runtime
+	reservedFDs = 64
+)
+
+// parseParallel parses -parallel: "0" means unlimited, "auto" picks a limit
+// for the number of targets, anything else is an explicit limit
+func parseParallel(value string, targets int) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "auto" {
+		return autoParallel(targets, fileLimit()), nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid -parallel '%s': expected a number >= 0 or 'auto'", value)
+	}
+	return n, nil
+}
+
+// autoParallel runs every target at once when the open file limit allows it,
+// otherwise as many as fit in the limit (fdsPerHost each, after reservedFDs),
+// never more than maxAutoParallel. A limit of 0 means unknown
+func autoParallel(targets int, limit uint64) int {
+	n := min(targets, maxAutoParallel)
+	if limit > 0 {
+		budget := 1
+		if limit > reservedFDs+fdsPerHost {
+			budget = int((limit - reservedFDs) / fdsPerHost)
+		}
+		n = min(n, budget)
+	}
+	return max(n, 1)
+}
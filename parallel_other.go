@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// fileLimit returns 0 (unknown) on platforms without rlimits
+func fileLimit() uint64 {
+	return 0
+}
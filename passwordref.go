@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// resolvePassword resolves a password reference so real secrets can stay out
+// of the config: "env:NAME" reads an environment variable and "file:PATH"
+// reads a file (trailing newline removed). Other values are used as is
+func resolvePassword(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		password, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s is not set", name)
+		}
+		return password, nil
+	case strings.HasPrefix(value, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// isPasswordRef reports whether value is an env: or file: reference
+func isPasswordRef(value string) bool {
+	return strings.HasPrefix(value, "env:") || strings.HasPrefix(value, "file:")
+}
+
+// checkRemotePasswords rejects password references in a config fetched from a
+// URL: its author picks the hosts, and resolving them would send local
+// secrets to those hosts
+func checkRemotePasswords(vpsList []VPS, defaults ConfigDefaults) error {
+	if isPasswordRef(defaults.Password) {
+		return fmt.Errorf("defaults: env: and file: passwords are not allowed in a config loaded from a URL")
+	}
+	for i, vps := range vpsList {
+		if isPasswordRef(vps.Password) {
+			return fmt.Errorf("VPS entry %d: env: and file: passwords are not allowed in a config loaded from a URL", i+1)
+		}
+	}
+	return nil
+}
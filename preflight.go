@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// unreachableHost is a VPS that failed the TCP preflight probe
+type unreachableHost struct {
+	VPS   VPS
+	Error error
+}
+
+// probeSSHPorts dials the SSH port of every VPS concurrently (TCP only, no
+// handshake or auth) and returns how long each connect took, or its error
+func probeSSHPorts(vpsList []VPS, timeout time.Duration, opts ExecOptions) ([]time.Duration, []error) {
+	var wg sync.WaitGroup
+	rtts := make([]time.Duration, len(vpsList))
+	errs := make([]error, len(vpsList))
+
+	for i := range vpsList {
+		wg.Add(1)
+		go func(idx int, vps VPS) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			dialer := net.Dialer{}
+			if opts.BindAddr != nil {
+				dialer.LocalAddr = opts.BindAddr
+			}
+			start := time.Now()
+			conn, err := dialer.DialContext(ctx, "tcp", sshAddr(vps))
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			rtts[idx] = time.Since(start)
+			conn.Close()
+		}(i, vpsList[i])
+	}
+	wg.Wait()
+	return rtts, errs
+}
+
+// probeReachability probes the SSH port of every VPS and returns the hosts
+// that could not be reached
+func probeReachability(vpsList []VPS, timeout time.Duration, opts ExecOptions) []unreachableHost {
+	_, errs := probeSSHPorts(vpsList, timeout, opts)
+
+	var unreachable []unreachableHost
+	for i, err := range errs {
+		if err != nil {
+			unreachable = append(unreachable, unreachableHost{VPS: vpsList[i], Error: err})
+		}
+	}
+	return unreachable
+}
+
+// formatUnreachable renders the preflight failures, one host per line
+func formatUnreachable(hosts []unreachableHost) string {
+	var s string
+	for _, h := range hosts {
+		s += fmt.Sprintf("  %s (%s): %v\n", h.VPS.Name, sshAddr(h.VPS), h.Error)
+	}
+	return s
+}
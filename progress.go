@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// progressMeter keeps a "[42/150] completed (3 failed)" line up to date on a
+// terminal while a batch runs. Counters are atomic so hosts can record from
+// their own goroutines. A nil *progressMeter does nothing
+type progressMeter struct {
+	w         io.Writer
+	total     int
+	completed atomic.Int64
+	failed    atomic.Int64
+}
+
+// newProgressMeter returns a progressMeter for a batch of total hosts
+func newProgressMeter(w io.Writer, total int) *progressMeter {
+	return &progressMeter{w: w, total: total}
+}
+
+// record counts a finished host
+func (p *progressMeter) record(result Result) {
+	if p == nil {
+		return
+	}
+	p.completed.Add(1)
+	if !result.Success && !result.Skipped {
+		p.failed.Add(1)
+	}
+}
+
+// show redraws the progress line in place
+func (p *progressMeter) show() {
+	if p == nil {
+		return
+	}
+	fmt.Fprintf(p.w, "\r\033[K[%d/%d] completed (%d failed)", p.completed.Load(), p.total, p.failed.Load())
+}
+
+// clear erases the progress line, so other output starts on a clean line
+func (p *progressMeter) clear() {
+	if p == nil {
+		return
+	}
+	fmt.Fprint(p.w, "\r\033[K")
+}
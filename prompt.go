@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// promptCommand asks for the command on the terminal and returns the trimmed
+// line the user typed
+func promptCommand(in io.Reader) (string, error) {
+	fmt.Fprint(os.Stderr, "Command to run: ")
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read command: %v", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// confirmPreviewHosts is how many host names -confirm lists before "and N more"
+const confirmPreviewHosts = 5
+
+// confirmRun shows the targets and the command and asks for "yes" on in,
+// reporting whether the user agreed
+func confirmRun(in io.Reader, vpsList []VPS, command string) (bool, error) {
+	names := make([]string, 0, confirmPreviewHosts)
+	for _, vps := range vpsList {
+		if len(names) == confirmPreviewHosts {
+			break
+		}
+		names = append(names, hostKey(vps))
+	}
+	preview := strings.Join(names, ", ")
+	if more := len(vpsList) - len(names); more > 0 {
+		preview += fmt.Sprintf(" and %d more", more)
+	}
+
+	fmt.Fprintf(os.Stderr, "About to run on %d host(s): %s\n", len(vpsList), preview)
+	fmt.Fprintf(os.Stderr, "Command: %s\n", command)
+	fmt.Fprint(os.Stderr, "Type yes to continue: ")
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read confirmation: %v", err)
+	}
+	return strings.TrimSpace(line) == "yes", nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// quietResult is what -quiet prints for a host: a successful host is cut down
+// to its status line, a failed one keeps its output and error
+func quietResult(result Result) Result {
+	if !result.Success {
+		return result
+	}
+	result.Stdout, result.Stderr = "", ""
+	result.RemoteStart, result.RemoteEnd = time.Time{}, time.Time{}
+	return result
+}
+
+// quietResults applies quietResult to a copy of results
+func quietResults(results []Result) []Result {
+	quieted := make([]Result, len(results))
+	for i, result := range results {
+		quieted[i] = quietResult(result)
+	}
+	return quieted
+}
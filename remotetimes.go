@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marker lines written to stderr around the command by withRemoteTimes
+const (
+	remoteStartMarker = "__AXION_START__ "
+	remoteEndMarker   = "__AXION_END__ "
+)
+
+// withRemoteTimes wraps command to print the remote clock on stderr right
+// before and after it runs. The command runs in a subshell so an "exit" in it
+// still reaches the end timestamp; its exit status is kept
+func withRemoteTimes(command string) string {
+	var b strings.Builder
+	b.WriteString("printf '" + remoteStartMarker + "%s\\n' \"$(date +%s.%N)\" >&2\n")
+	b.WriteString("(\n" + command + "\n)\n")
+	b.WriteString("__axion_times_rc=$?\n")
+	b.WriteString("printf '\\n" + remoteEndMarker + "%s\\n' \"$(date +%s.%N)\" >&2\n")
+	b.WriteString("exit $__axion_times_rc")
+	return b.String()
+}
+
+// parseRemoteTimes strips the withRemoteTimes markers from stderr and returns
+// the remote start and end times. A time is zero when its marker is missing
+// (e.g., the command was killed) or the remote date lacks %N support
+func parseRemoteTimes(stderr string) (string, time.Time, time.Time) {
+	var start, end time.Time
+
+	if strings.HasPrefix(stderr, remoteStartMarker) {
+		line, rest, _ := strings.Cut(stderr, "\n")
+		start = parseEpoch(strings.TrimPrefix(line, remoteStartMarker))
+		stderr = rest
+	}
+
+	// The end marker is preceded by an extra newline in case the command's
+	// stderr didn't end with one
+	if i := strings.LastIndex(stderr, "\n"+remoteEndMarker); i >= 0 && strings.HasSuffix(stderr, "\n") {
+		line := strings.TrimSuffix(stderr[i+1:], "\n")
+		if !strings.Contains(line, "\n") {
+			end = parseEpoch(strings.TrimPrefix(line, remoteEndMarker))
+			stderr = stderr[:i]
+		}
+	}
+
+	return stderr, start, end
+}
+
+// parseEpoch parses "seconds.nanoseconds" as printed by date +%s.%N
+func parseEpoch(s string) time.Time {
+	secs, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	var nsec int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		if nsec, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}
+		}
+	}
+	return time.Unix(sec, nsec)
+}
+
+// formatRemoteTimes describes when a command ran on the remote clock, and how
+// much of the locally measured duration was session overhead
+func formatRemoteTimes(result Result) string {
+	const layout = "2006-01-02T15:04:05.000Z07:00"
+	line := "REMOTE: started " + result.RemoteStart.Format(layout)
+	if result.RemoteEnd.IsZero() {
+		return line + ", end not reported"
+	}
+	ran := result.RemoteEnd.Sub(result.RemoteStart)
+	line += ", finished " + result.RemoteEnd.Format(layout) + ", ran " + ran.Round(time.Millisecond).String()
+	if overhead := result.Duration - ran; overhead > 0 {
+		line += " (+" + overhead.Round(time.Millisecond).String() + " session overhead)"
+	}
+	return line
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// resultSortKeys are the orders accepted by -sort
+var resultSortKeys = []string{"number", "name", "status"}
+
+// parseResultSort validates a -sort value
+func parseResultSort(key string) error {
+	for _, k := range resultSortKeys {
+		if key == k {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid -sort '%s': expected number, name or status", key)
+}
+
+// statusRank orders results for -sort status: failures first, then skipped
+// hosts, then successes
+func statusRank(result Result) int {
+	switch {
+	case result.Success:
+		return 2
+	case result.Skipped:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// sortResults reorders results by key. The sort is stable, so hosts that
+// compare equal (e.g., names without numbers) keep the target order
+func sortResults(results []Result, key string) {
+	var less func(a, b Result) bool
+	switch key {
+	case "number":
+		number := func(result Result) int {
+			if num, err := extractNumberFromName(result.VPS.Name); err == nil {
+				return num
+			}
+			return math.MaxInt
+		}
+		less = func(a, b Result) bool { return number(a) < number(b) }
+	case "name":
+		less = func(a, b Result) bool { return a.VPS.Name < b.VPS.Name }
+	case "status":
+		less = func(a, b Result) bool { return statusRank(a) < statusRank(b) }
+	default:
+		return
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return less(results[i], results[j])
+	})
+}
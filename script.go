@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readCommand reads a command body from a -script file, or from in for
+// "-c -". The body is returned unchanged, newlines included, so a whole
+// shell snippet runs on each host
+func readCommand(scriptPath string, in io.Reader) (string, error) {
+	var data []byte
+	var err error
+	if scriptPath != "" {
+		data, err = os.ReadFile(scriptPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read script: %v", err)
+		}
+	} else {
+		data, err = io.ReadAll(in)
+		if err != nil {
+			return "", fmt.Errorf("failed to read command from stdin: %v", err)
+		}
+	}
+
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("command is empty")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// labelSelection appends to each VPS the selector that kept it in the target
+// list, so overlapping or broad selectors can be explained later
+func labelSelection(vpsList []VPS, label func(vps VPS) string) {
+	for i := range vpsList {
+		if vpsList[i].selector == "" {
+			vpsList[i].selector = label(vpsList[i])
+		} else {
+			vpsList[i].selector += ", " + label(vpsList[i])
+		}
+	}
+}
+
+// numberLabel describes a match on the number in a VPS name
+func numberLabel(flagName, spec string) func(vps VPS) string {
+	return func(vps VPS) string {
+		num, _ := extractNumberFromName(vps.Name)
+		if flagName == "-i" {
+			return fmt.Sprintf("-i %d", num)
+		}
+		return fmt.Sprintf("%s %s (number %d)", flagName, spec, num)
+	}
+}
+
+// writeSelectionReport writes which selector matched each host
+func writeSelectionReport(w io.Writer, results []Result) {
+	fmt.Fprintln(w, "Selected by:")
+	for _, result := range results {
+		fmt.Fprintf(w, "  [%s] %s\n", result.VPS.Name, strings.TrimSpace(result.MatchedBy))
+	}
+}
+
+// writeDryRun lists the hosts a run would target, in the order they would
+// be started, without connecting to any of them
+func writeDryRun(w io.Writer, vpsList []VPS, command string) {
+	fmt.Fprintf(w, "Dry run: %d host(s) would run: %s\n", len(vpsList), command)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, vps := range vpsList {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", vps.Name, sshAddr(vps), strings.TrimSpace(vps.selector))
+	}
+	tw.Flush()
+}
+
+// matchNamePattern compiles a -name pattern: "/regex/" is a regular
+// expression matched anywhere in the name, anything else a glob matched
+// against the whole name (e.g., "db-*", "eu-west-?")
+func matchNamePattern(pattern string) (func(name string) bool, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid -name regex '%s': %v", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid -name glob '%s': %v", pattern, err)
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}, nil
+}
+
+// findVPSByPattern finds every VPS whose name matches a -name pattern
+func findVPSByPattern(vpsList []VPS, pattern string) ([]VPS, error) {
+	match, err := matchNamePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []VPS
+	for i := range vpsList {
+		if vpsList[i].Name != "" && match(vpsList[i].Name) {
+			matched = append(matched, vpsList[i])
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no VPS name matches '%s'", pattern)
+	}
+	return matched, nil
+}
+
+// findVPSByTags finds every VPS carrying at least one of tags. Tags match
+// exactly, so key=value tags are selected with the whole tag (e.g., role=scanner)
+func findVPSByTags(vpsList []VPS, tags []string) ([]VPS, error) {
+	var matched []VPS
+	for i := range vpsList {
+		if slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(vpsList[i].Tags, tag) }) {
+			matched = append(matched, vpsList[i])
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no VPS is tagged %s", strings.Join(tags, " or "))
+	}
+	return matched, nil
+}
+
+// tagLabel describes a -tag match with the tags of the VPS that matched
+func tagLabel(tags []string) func(vps VPS) string {
+	return func(vps VPS) string {
+		var hit []string
+		for _, tag := range tags {
+			if slices.Contains(vps.Tags, tag) {
+				hit = append(hit, "-tag "+tag)
+			}
+		}
+		return strings.Join(hit, ", ")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// sequenceTask returns a hostTask that runs commands one after another on
+// each VPS over a single connection, stopping at the first failure. The
+// host's result combines the output of every command that ran
+func sequenceTask(commands []string, opts ExecOptions) hostTask {
+	return func(ctx context.Context, vps VPS) Result {
+		if opts.Executor != nil {
+			return runSequence(Result{VPS: vps, ExitCode: -1}, commands, opts, func(command string) Result {
+				return opts.Executor.Execute(ctx, vps, command)
+			})
+		}
+		return executeSequence(ctx, vps, commands, opts)
+	}
+}
+
+// executeSequence connects to a VPS once and runs commands in order, each in
+// its own session on that connection
+func executeSequence(ctx context.Context, vps VPS, commands []string, opts ExecOptions) Result {
+	result := Result{
+		VPS:      vps,
+		ExitCode: -1,
+	}
+
+	client, err := connectAttempt(ctx, vps, opts, &result)
+	if err != nil {
+		if ctx.Err() != nil {
+			return skipResult(result, ctx.Err())
+		}
+		result.Error = connectError(err)
+		result.Success = false
+		return result
+	}
+	defer client.Close()
+
+	// Every command would truncate the output files, write them once at the end
+	stepOpts := opts
+	stepOpts.OutDir = ""
+	connected := result
+	result = runSequence(connected, commands, opts, func(command string) Result {
+		return executeOnClient(ctx, client, connected, command, stepOpts)
+	})
+	if opts.OutDir != "" {
+		if err := writeOutputFiles(opts.OutDir, result); err != nil && result.Success {
+			result.Error = fmt.Errorf("failed to create output files: %v", err)
+			result.Success = false
+		}
+	}
+	return result
+}
+
+// runSequence calls run for each command until one doesn't succeed and
+// merges the results into base. The error of a failed command names its
+// position, which is also kept in FailedCommand
+func runSequence(base Result, commands []string, opts ExecOptions, run func(command string) Result) Result {
+	result := base
+	for i, command := range commands {
+		step := run(command)
+
+		result.Stdout += step.Stdout
+		result.Stderr += step.Stderr
+		result.StdoutBytes += step.StdoutBytes
+		result.StderrBytes += step.StderrBytes
+		result.Duration += step.Duration
+		if result.RemoteStart.IsZero() {
+			result.RemoteStart = step.RemoteStart
+		}
+		result.RemoteEnd = step.RemoteEnd
+		result.ExitCode = step.ExitCode
+		result.EnvVia = step.EnvVia
+		result.SudoAuthFailed = step.SudoAuthFailed
+		result.Cleanup = step.Cleanup
+		result.Success = step.Success
+		result.Skipped = step.Skipped
+		result.Error = step.Error
+		if step.Addr != "" {
+			result.Addr = step.Addr
+		}
+
+		if !step.Success {
+			if !step.Skipped {
+				result.FailedCommand = i + 1
+				result.Error = fmt.Errorf("command %d of %d: %v", i+1, len(commands), step.Error)
+			}
+			break
+		}
+	}
+	result.Slow = opts.WarnAfter > 0 && result.Duration > opts.WarnAfter
+	return result
+}
+
+// writeOutputFiles writes a finished result's output to <name>.stdout and
+// <name>.stderr in dir
+func writeOutputFiles(dir string, result Result) error {
+	base := filepath.Join(dir, outputFileBase(result.VPS))
+	if err := os.WriteFile(base+".stdout", []byte(result.Stdout), 0666); err != nil {
+		return err
+	}
+	return os.WriteFile(base+".stderr", []byte(result.Stderr), 0666)
+}
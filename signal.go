@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// killSignals are the signal names accepted by -kill-signal
+var killSignals = map[string]ssh.Signal{
+	"ABRT": ssh.SIGABRT,
+	"ALRM": ssh.SIGALRM,
+	"HUP":  ssh.SIGHUP,
+	"INT":  ssh.SIGINT,
+	"KILL": ssh.SIGKILL,
+	"QUIT": ssh.SIGQUIT,
+	"TERM": ssh.SIGTERM,
+	"USR1": ssh.SIGUSR1,
+	"USR2": ssh.SIGUSR2,
+}
+
+// parseKillSignal parses a signal name such as "TERM" or "SIGKILL"
+func parseKillSignal(name string) (ssh.Signal, error) {
+	sig, ok := killSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return "", fmt.Errorf("unsupported kill signal '%s': expected one of TERM, INT, HUP, QUIT, KILL, USR1, USR2, ALRM, ABRT", name)
+	}
+	return sig, nil
+}
+
+// stopOnDone arranges for a running command to be stopped once ctx is done.
+// With a kill signal configured the signal is sent first and the connection is
+// only closed if the command hasn't exited within grace. Close finished once
+// the command has exited; the returned func unregisters the handler
+func stopOnDone(ctx context.Context, client *ssh.Client, session *ssh.Session, opts ExecOptions, finished <-chan struct{}) func() bool {
+	return context.AfterFunc(ctx, func() {
+		if opts.KillSignal != "" {
+			session.Signal(opts.KillSignal)
+			select {
+			case <-finished:
+				return
+			case <-time.After(opts.KillGrace):
+			}
+		}
+		client.Close()
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// loadSSHConfig parses an OpenSSH client config (e.g., ~/.ssh/config) for
+// -ssh-config
+func loadSSHConfig(path string) (*ssh_config.Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ssh config not found at %s", path)
+	}
+	defer f.Close()
+
+	cfg, err := ssh_config.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// applySSHConfig fills the connection fields a VPS leaves blank (HostName,
+// Port, User and IdentityFile) from the ssh config Host blocks matching its
+// name. Anything set in the YAML wins; a nil cfg does nothing
+func applySSHConfig(vps *VPS, cfg *ssh_config.Config) error {
+	if cfg == nil || vps.Name == "" {
+		return nil
+	}
+	get := func(key string) (string, error) {
+		value, err := cfg.Get(vps.Name, key)
+		if err != nil {
+			return "", fmt.Errorf("ssh config %s for %s: %v", key, vps.Name, err)
+		}
+		return value, nil
+	}
+
+	if vps.IP == "" && len(vps.IPs) == 0 {
+		hostName, err := get("HostName")
+		if err != nil {
+			return err
+		}
+		vps.IP = strings.ReplaceAll(hostName, "%h", vps.Name)
+	}
+	if vps.Port == 0 && !strings.Contains(vps.IP, ":") {
+		port, err := get("Port")
+		if err != nil {
+			return err
+		}
+		if port != "" {
+			if vps.Port, err = strconv.Atoi(port); err != nil {
+				return fmt.Errorf("ssh config Port for %s: invalid port '%s'", vps.Name, port)
+			}
+		}
+	}
+	if vps.Username == "" {
+		user, err := get("User")
+		if err != nil {
+			return err
+		}
+		vps.Username = user
+	}
+	if vps.Password == "" && vps.Secret == "" {
+		identity, err := get("IdentityFile")
+		if err != nil {
+			return err
+		}
+		vps.Secret = identity
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// hostStdin returns the data piped to a host's command: the -stdin contents,
+// or <StdinDir>/<name> for per-host data. A nil reader means no input
+func hostStdin(vps VPS, opts ExecOptions) (io.Reader, error) {
+	if opts.StdinDir != "" {
+		data, err := os.ReadFile(filepath.Join(opts.StdinDir, outputFileBase(vps)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin data: %v", err)
+		}
+		return bytes.NewReader(data), nil
+	}
+	if opts.Stdin != nil {
+		return bytes.NewReader(opts.Stdin), nil
+	}
+	return nil, nil
+}
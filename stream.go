@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// streamPrinter writes -stream output from every host as it arrives. Whole
+// lines are written under one lock so hosts interleave by line, never mid-line
+type streamPrinter struct {
+	mu sync.Mutex
+}
+
+// printf writes a formatted message to w without splitting any streamed line
+func (p *streamPrinter) printf(w io.Writer, format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(w, format, args...)
+}
+
+// writer returns a writer that prefixes each line with the VPS name and
+// passes it to w once the line is complete
+func (p *streamPrinter) writer(w io.Writer, vps VPS, masks []*regexp.Regexp) *streamWriter {
+	return &streamWriter{p: p, w: w, prefix: "[" + vps.Name + "] ", masks: masks}
+}
+
+// streamWriter is one host's stdout or stderr in -stream mode
+type streamWriter struct {
+	p      *streamPrinter
+	w      io.Writer
+	prefix string
+	masks  []*regexp.Regexp
+	buf    []byte
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i == -1 {
+			break
+		}
+		s.writeLine(string(s.buf[:i]))
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any trailing partial line
+func (s *streamWriter) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	s.writeLine(string(s.buf))
+	s.buf = nil
+	return nil
+}
+
+func (s *streamWriter) writeLine(line string) {
+	// -remote-times markers are parsed out of the result, don't show them
+	if strings.HasPrefix(line, remoteStartMarker) || strings.HasPrefix(line, remoteEndMarker) {
+		return
+	}
+	s.p.printf(s.w, "%s%s\n", s.prefix, maskOutput(line, s.masks))
+}
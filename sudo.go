@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+)
+
+// sudoFeeder answers "sudo -S" for one session. It sits on the command's
+// stderr: the password is written when sudo's prompt shows up, and the
+// command's own stdin is passed on only once the command has started. A sudo
+// that doesn't ask (NOPASSWD, cached credentials) never gets the password, so
+// it can't end up in the command's input
+type sudoFeeder struct {
+	prompt   []byte // Unique prompt given to sudo -p
+	ready    []byte // Printed on stderr once sudo has let the command run
+	password string
+	stdin    io.Reader // Input for the command itself, nil for none
+	out      io.Writer // Stderr with the markers removed
+	pr       *io.PipeReader
+	pw       *io.PipeWriter
+	pending  []byte // Stderr held back in case it is the start of a marker
+	removed  int64  // Bytes of markers taken out of stderr
+	prompted bool
+	started  bool
+}
+
+func newSudoFeeder(password string, stdin io.Reader, out io.Writer) *sudoFeeder {
+	id := make([]byte, 8)
+	rand.Read(id)
+	tag := hex.EncodeToString(id)
+	pr, pw := io.Pipe()
+	return &sudoFeeder{
+		prompt:   []byte("[axion-sudo-" + tag + "-p]"),
+		ready:    []byte("[axion-sudo-" + tag + "-r]"),
+		password: password,
+		stdin:    stdin,
+		out:      out,
+		pr:       pr,
+		pw:       pw,
+	}
+}
+
+// command wraps command to run through "sudo -S" with the feeder's prompt,
+// optionally as a specific target user
+func (f *sudoFeeder) command(command, user string) string {
+	sudo := "sudo -S -p " + shellQuote(string(f.prompt))
+	if user != "" {
+		sudo += " -u " + shellQuote(user)
+	}
+	script := "printf '%s' " + shellQuote(string(f.ready)) + " >&2\n" + command
+	return sudo + " sh -c " + shellQuote(script)
+}
+
+// Write takes the command's stderr, acting on and removing the markers
+func (f *sudoFeeder) Write(p []byte) (int, error) {
+	if f.started {
+		f.out.Write(p)
+		return len(p), nil
+	}
+
+	f.pending = append(f.pending, p...)
+	for !f.started {
+		i, marker := f.nextMarker()
+		if i < 0 {
+			break
+		}
+		f.out.Write(f.pending[:i])
+		f.pending = f.pending[i+len(marker):]
+		f.removed += int64(len(marker))
+		if bytes.Equal(marker, f.ready) {
+			f.start()
+		} else {
+			f.answer()
+		}
+	}
+
+	keep := 0
+	if !f.started {
+		keep = min(len(f.pending), len(f.prompt)-1)
+	}
+	f.out.Write(f.pending[:len(f.pending)-keep])
+	f.pending = append([]byte(nil), f.pending[len(f.pending)-keep:]...)
+	return len(p), nil
+}
+
+// nextMarker returns the position and value of the first marker in the
+// pending stderr, or -1 if there is none yet
+func (f *sudoFeeder) nextMarker() (int, []byte) {
+	p := bytes.Index(f.pending, f.prompt)
+	r := bytes.Index(f.pending, f.ready)
+	if p >= 0 && (r < 0 || p < r) {
+		return p, f.prompt
+	}
+	return r, f.ready
+}
+
+// answer writes the password at sudo's first prompt. Another prompt means it
+// was rejected, so stdin is closed to make sudo give up
+func (f *sudoFeeder) answer() {
+	if f.prompted {
+		f.pw.Close()
+		return
+	}
+	f.prompted = true
+	io.WriteString(f.pw, f.password+"\n")
+}
+
+// start hands the session's stdin over to the command's own input
+func (f *sudoFeeder) start() {
+	f.started = true
+	if f.stdin == nil {
+		f.pw.Close()
+		return
+	}
+	go func() {
+		_, err := io.Copy(f.pw, f.stdin)
+		f.pw.CloseWithError(err)
+	}()
+}
+
+// finish passes on held back stderr and ends the session's stdin if the
+// command never started. Call it once stderr has been read to the end
+func (f *sudoFeeder) finish() {
+	f.out.Write(f.pending)
+	f.pending = nil
+	if !f.started {
+		f.pw.Close()
+	}
+}
+
+// authFailed reports whether sudo refused to run the command (wrong password,
+// not a sudoer): it exited with status 1 before the command started. Call it
+// after finish
+func (f *sudoFeeder) authFailed(exitStatus int) bool {
+	return !f.started && exitStatus == 1
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runSummary is the compact aggregate written by -summary-json
+type runSummary struct {
+	Total       int            `json:"total"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	Skipped     int            `json:"skipped"`
+	FailedHosts []string       `json:"failed_hosts"`
+	ExitCodes   map[string]int `json:"exit_codes,omitempty"` // Remote exit code of each failed host that reported one
+	Categories  map[string]int `json:"categories,omitempty"` // Number of failed hosts per connection failure category
+	SlowHosts   []string       `json:"slow_hosts,omitempty"`
+
+	OutputBytes    int64        `json:"output_bytes"`
+	TopOutputHosts []hostOutput `json:"top_output_hosts,omitempty"`
+}
+
+// summarize counts the outcomes of a batch
+func summarize(results []Result) runSummary {
+	summary := runSummary{Total: len(results), FailedHosts: []string{}}
+	for _, result := range results {
+		switch {
+		case result.Success:
+			summary.Succeeded++
+		case result.Skipped:
+			summary.Skipped++
+		default:
+			summary.Failed++
+			summary.FailedHosts = append(summary.FailedHosts, hostKey(result.VPS))
+			if result.ExitCode >= 0 {
+				if summary.ExitCodes == nil {
+					summary.ExitCodes = make(map[string]int)
+				}
+				summary.ExitCodes[hostKey(result.VPS)] = result.ExitCode
+			}
+			if result.Category != "" {
+				if summary.Categories == nil {
+					summary.Categories = make(map[string]int)
+				}
+				summary.Categories[result.Category]++
+			}
+		}
+		if result.Slow {
+			summary.SlowHosts = append(summary.SlowHosts, hostKey(result.VPS))
+		}
+	}
+	summary.OutputBytes, summary.TopOutputHosts = largestOutputs(results, topOutputHosts)
+	return summary
+}
+
+// writeSummaryLine writes the one-line outcome count printed after a batch
+func writeSummaryLine(w io.Writer, results []Result) {
+	summary := summarize(results)
+	fmt.Fprintf(w, "SUMMARY: %d hosts, %d succeeded, %d failed", summary.Total, summary.Succeeded, summary.Failed)
+	var categories []string
+	for _, category := range connectCategories {
+		if n := summary.Categories[category]; n > 0 {
+			categories = append(categories, fmt.Sprintf("%d %s", n, category))
+		}
+	}
+	if len(categories) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(categories, ", "))
+	}
+	if summary.Skipped > 0 {
+		fmt.Fprintf(w, ", %d skipped", summary.Skipped)
+	}
+	fmt.Fprintln(w)
+}
+
+// writeSlowReport lists the hosts whose command ran longer than warnAfter
+func writeSlowReport(w io.Writer, results []Result, warnAfter time.Duration) {
+	var slow []Result
+	for _, result := range results {
+		if result.Slow {
+			slow = append(slow, result)
+		}
+	}
+	if len(slow) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Warning: %d host(s) ran longer than %s:\n", len(slow), warnAfter)
+	for _, result := range slow {
+		fmt.Fprintf(w, "  %s: %s\n", result.VPS.Name, result.Duration.Round(time.Second))
+	}
+}
+
+// writeSummaryJSON writes the batch summary as one line of JSON to path,
+// or to stdout when path is "-"
+func writeSummaryJSON(path string, results []Result) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to write summary: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return json.NewEncoder(w).Encode(summarize(results))
+}
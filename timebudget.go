@@ -0,0 +1,17 @@
+package main
+
+import "time"
+
+// budgetHostTimeout splits a total time budget across the waves a batch of
+// hosts runs in under the given concurrency (0 = all at once), so that every
+// wave finishing within its share keeps the batch inside the budget
+func budgetHostTimeout(budget time.Duration, hosts, parallel int) time.Duration {
+	if parallel <= 0 || parallel > hosts {
+		parallel = hosts
+	}
+	if parallel <= 0 {
+		return budget
+	}
+	waves := (hosts + parallel - 1) / parallel
+	return budget / time.Duration(waves)
+}
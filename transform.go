@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// applyTransform pipes the result's stdout through a local shell command and
+// replaces it with the command's output. AXION_HOST and AXION_IP identify the
+// host to the command. On failure the original stdout is kept and the error is
+// recorded in TransformError
+func applyTransform(result Result, command string) Result {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(result.Stdout)
+	cmd.Env = append(os.Environ(), "AXION_HOST="+result.VPS.Name, "AXION_IP="+result.VPS.IP)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+		result.TransformError = fmt.Errorf("transform failed: %v", err)
+		return result
+	}
+
+	result.Stdout = stdout.String()
+	return result
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// UploadSpec describes a local file to copy to every selected VPS
+type UploadSpec struct {
+	LocalPath  string
+	RemotePath string
+	Verify     bool   // Compare the remote sha256sum against SHA256 after upload
+	SHA256     string // Hex SHA256 of the local file, computed once before the batch
+}
+
+// parseUploadSpec parses an -upload value of the form LOCAL:REMOTE
+func parseUploadSpec(spec string) (UploadSpec, error) {
+	local, remote, ok := strings.Cut(spec, ":")
+	if !ok || local == "" || remote == "" {
+		return UploadSpec{}, fmt.Errorf("invalid upload '%s': expected LOCAL:REMOTE", spec)
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return UploadSpec{}, fmt.Errorf("cannot read upload source: %v", err)
+	}
+	if info.IsDir() {
+		return UploadSpec{}, fmt.Errorf("upload source %s is a directory", local)
+	}
+
+	return UploadSpec{LocalPath: local, RemotePath: remote}, nil
+}
+
+// fileSHA256 returns the hex encoded SHA256 of a local file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// uploadTask returns a hostTask that uploads spec to each VPS, then runs
+// command (if any) on the same connection
+func uploadTask(spec UploadSpec, command string, opts ExecOptions) hostTask {
+	return func(ctx context.Context, vps VPS) Result {
+		return uploadFile(ctx, vps, spec, command, opts)
+	}
+}
+
+// uploadFile copies the local file to the VPS over SFTP and, if requested,
+// verifies the remote copy by comparing its sha256sum with the local hash.
+// A non-empty command runs only once the upload succeeded
+func uploadFile(ctx context.Context, vps VPS, spec UploadSpec, command string, opts ExecOptions) Result {
+	result := Result{
+		VPS:      vps,
+		ExitCode: -1,
+	}
+
+	client, err := connectAttempt(ctx, vps, opts, &result)
+	if err != nil {
+		if ctx.Err() != nil {
+			return skipResult(result, ctx.Err())
+		}
+		result.Error = connectError(err)
+		return result
+	}
+	defer client.Close()
+	defer context.AfterFunc(ctx, func() { client.Close() })()
+
+	written, err := copyOverSFTP(client, spec.LocalPath, spec.RemotePath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return skipResult(result, ctx.Err())
+		}
+		result.Error = fmt.Errorf("upload failed: %v", err)
+		return result
+	}
+	result.Stdout = fmt.Sprintf("uploaded %s -> %s (%d bytes)", spec.LocalPath, spec.RemotePath, written)
+
+	if spec.Verify {
+		remoteSum, err := remoteSHA256(client, spec.RemotePath)
+		if err != nil {
+			if ctx.Err() != nil {
+				return skipResult(result, ctx.Err())
+			}
+			result.Error = fmt.Errorf("integrity check failed: %v", err)
+			return result
+		}
+		if remoteSum != spec.SHA256 {
+			result.Error = fmt.Errorf("integrity check failed: remote sha256 %s does not match local %s", remoteSum, spec.SHA256)
+			return result
+		}
+		result.Stdout += fmt.Sprintf("\nsha256 verified: %s", remoteSum)
+	}
+
+	if command != "" {
+		uploaded := result.Stdout
+		result = executeOnClient(ctx, client, result, command, opts)
+		result.Stdout = strings.TrimSuffix(uploaded+"\n"+result.Stdout, "\n")
+		return result
+	}
+
+	result.Success = true
+	result.ExitCode = 0
+	return result
+}
+
+// copyOverSFTP copies a local file to remotePath, truncating any existing
+// file, and gives the remote file the local file's mode
+func copyOverSFTP(client *ssh.Client, localPath, remotePath string) (int64, error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start sftp: %v", err)
+	}
+	defer sftpClient.Close()
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := sftpClient.Create(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %v", remotePath, err)
+	}
+	defer dst.Close()
+
+	written, err := io.Copy(dst, src)
+	if err != nil {
+		return written, err
+	}
+	if err := dst.Chmod(info.Mode().Perm()); err != nil {
+		return written, fmt.Errorf("failed to set mode on %s: %v", remotePath, err)
+	}
+	return written, dst.Close()
+}
+
+// remoteSHA256 runs sha256sum on the VPS and returns the hex digest of path
+func remoteSHA256(client *ssh.Client, path string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %v", err)
+	}
+	defer session.Close()
+
+	out, err := session.Output("sha256sum -- " + shellQuote(path))
+	if err != nil {
+		return "", fmt.Errorf("sha256sum failed: %v", err)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("sha256sum returned no output")
+	}
+	return fields[0], nil
+}
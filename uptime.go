@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// uptimeCommand reads the kernel uptime and load averages in one round trip
+const uptimeCommand = "cat /proc/uptime /proc/loadavg"
+
+// UptimeInfo holds the parsed output of uptimeCommand
+type UptimeInfo struct {
+	Uptime time.Duration
+	Load1  float64
+	Load5  float64
+	Load15 float64
+}
+
+// parseUptime parses the output of uptimeCommand
+// (e.g., "3605.12 7001.33\n0.15 0.10 0.05 1/123 4567\n")
+func parseUptime(output string) (*UptimeInfo, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected uptime output: %q", output)
+	}
+
+	uptimeFields := strings.Fields(lines[0])
+	if len(uptimeFields) < 1 {
+		return nil, fmt.Errorf("unexpected /proc/uptime output: %q", lines[0])
+	}
+	seconds, err := strconv.ParseFloat(uptimeFields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uptime seconds '%s': %v", uptimeFields[0], err)
+	}
+
+	loadFields := strings.Fields(lines[1])
+	if len(loadFields) < 3 {
+		return nil, fmt.Errorf("unexpected /proc/loadavg output: %q", lines[1])
+	}
+	var loads [3]float64
+	for i := range loads {
+		loads[i], err = strconv.ParseFloat(loadFields[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid load average '%s': %v", loadFields[i], err)
+		}
+	}
+
+	return &UptimeInfo{
+		Uptime: time.Duration(seconds * float64(time.Second)),
+		Load1:  loads[0],
+		Load5:  loads[1],
+		Load15: loads[2],
+	}, nil
+}
+
+// applyUptime parses the uptime output of each successful result into
+// Result.Uptime, marking results with unparseable output as failed
+func applyUptime(results []Result) {
+	for i := range results {
+		if !results[i].Success {
+			continue
+		}
+		info, err := parseUptime(results[i].Stdout)
+		if err != nil {
+			results[i].Success = false
+			results[i].Error = err
+			continue
+		}
+		results[i].Uptime = info
+	}
+}
+
+// formatUptime renders an uptime as days, hours and minutes (e.g., "12d 3h 4m")
+func formatUptime(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// printUptimeTable prints an aligned uptime/load table for all results
+func printUptimeTable(results []Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tIP\tUPTIME\tLOAD1\tLOAD5\tLOAD15")
+	for _, result := range results {
+		if result.Uptime == nil {
+			fmt.Fprintf(w, "%s\t%s\tERROR: %v\t\t\t\n", result.VPS.Name, result.VPS.IP, result.Error)
+			continue
+		}
+		u := result.Uptime
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%.2f\t%.2f\n", result.VPS.Name, result.VPS.IP, formatUptime(u.Uptime), u.Load1, u.Load5, u.Load15)
+	}
+	w.Flush()
+}
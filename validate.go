@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// checkConfig looks for the foot-guns loadConfig accepts: duplicate names
+// are errors, since -n can only ever pick the first; duplicate addresses,
+// names sharing a number and names without a trailing number are warnings
+func checkConfig(vpsList []VPS) (errs, warnings []string) {
+	byName := make(map[string][]int)
+	byAddr := make(map[string][]int)
+	var names, addrs []string
+	for i, vps := range vpsList {
+		entry := i + 1
+		if vps.Name != "" {
+			if len(byName[vps.Name]) == 0 {
+				names = append(names, vps.Name)
+			}
+			byName[vps.Name] = append(byName[vps.Name], entry)
+		}
+		addr := sshAddr(vps)
+		if len(byAddr[addr]) == 0 {
+			addrs = append(addrs, addr)
+		}
+		byAddr[addr] = append(byAddr[addr], entry)
+
+		switch _, err := extractNumberFromName(vps.Name); {
+		case vps.Name == "":
+			warnings = append(warnings, fmt.Sprintf("entry %d (%s) has no name: only -pos and -all can select it", entry, vps.IP))
+		case err != nil:
+			warnings = append(warnings, fmt.Sprintf("entry %d: name %s has no trailing number: -i, -l, -lowest and -highest never select it", entry, vps.Name))
+		}
+	}
+
+	for _, name := range names {
+		if entries := byName[name]; len(entries) > 1 {
+			errs = append(errs, fmt.Sprintf("name %s is used by entries %s: -n only selects the first", name, joinInts(entries)))
+		}
+	}
+	for _, addr := range addrs {
+		if entries := byAddr[addr]; len(entries) > 1 {
+			warnings = append(warnings, fmt.Sprintf("address %s is used by entries %s", addr, joinInts(entries)))
+		}
+	}
+
+	dups := duplicateNumbers(vpsList)
+	nums := make([]int, 0, len(dups))
+	for num := range dups {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		warnings = append(warnings, fmt.Sprintf("number %d is shared by %s: -i only selects %s, -l selects all of them", num, strings.Join(dups[num], ", "), dups[num][0]))
+	}
+	return errs, warnings
+}
+
+// joinInts formats entry numbers as a comma-separated list
+func joinInts(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, num := range nums {
+		parts[i] = fmt.Sprint(num)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// writeConfigReport writes the -validate report and returns whether the
+// config is free of errors
+func writeConfigReport(w io.Writer, path string, vpsList []VPS) bool {
+	errs, warnings := checkConfig(vpsList)
+	fmt.Fprintf(w, "Config %s: %d entries\n", path, len(vpsList))
+	for _, msg := range errs {
+		fmt.Fprintf(w, "Error: %s\n", msg)
+	}
+	for _, msg := range warnings {
+		fmt.Fprintf(w, "Warning: %s\n", msg)
+	}
+	if len(errs) == 0 && len(warnings) == 0 {
+		fmt.Fprintln(w, "OK")
+	} else {
+		fmt.Fprintf(w, "%d error(s), %d warning(s)\n", len(errs), len(warnings))
+	}
+	return len(errs) == 0
+}
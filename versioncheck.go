@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultVersionCommand is run on each host by -version-check
+const defaultVersionCommand = "axion -version"
+
+// versionRe matches a version token such as "v0.0.1" or "1.2"
+var versionRe = regexp.MustCompile(`v?\d+(\.\d+)+`)
+
+// normalizeVersion strips the optional "v" prefix so "v1.2" equals "1.2"
+func normalizeVersion(v string) string {
+	return strings.TrimPrefix(strings.TrimSpace(v), "v")
+}
+
+// applyVersionCheck extracts the reported version from each successful result
+// and marks hosts whose version differs from expected as failed
+func applyVersionCheck(results []Result, expected string) {
+	for i := range results {
+		if !results[i].Success {
+			continue
+		}
+		found := versionRe.FindString(results[i].Stdout)
+		if found == "" {
+			results[i].Success = false
+			results[i].Error = fmt.Errorf("no version found in output")
+			continue
+		}
+		results[i].Version = found
+		if normalizeVersion(found) != normalizeVersion(expected) {
+			results[i].Success = false
+			results[i].Error = fmt.Errorf("version mismatch: got %s, expected %s", found, expected)
+		}
+	}
+}
+
+// printVersionTable prints an aligned per-host version table
+func printVersionTable(results []Result, expected string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tIP\tVERSION\tSTATUS (expected %s)\n", expected)
+	for _, result := range results {
+		version := result.Version
+		if version == "" {
+			version = "-"
+		}
+		status := "OK"
+		if !result.Success {
+			status = fmt.Sprintf("MISMATCH: %v", result.Error)
+			if result.Version == "" {
+				status = fmt.Sprintf("ERROR: %v", result.Error)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.VPS.Name, result.VPS.IP, version, status)
+	}
+	w.Flush()
+}
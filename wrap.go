@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// umaskRe matches an octal umask such as "022" or "0027"
+var umaskRe = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// wrapCommand sandwiches command between prefix and suffix. The command's exit
+// status is saved, restored as $? for the suffix, and used as the final exit
+// code, so a suffix like "echo EXIT=$?" neither sees nor changes the wrong code
+func wrapCommand(command, prefix, suffix string) string {
+	prefix = trimSeparators(prefix)
+	suffix = trimSeparators(suffix)
+	if prefix == "" && suffix == "" {
+		return command
+	}
+
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(prefix + "\n")
+	}
+	b.WriteString(command + "\n")
+	if suffix == "" {
+		return b.String()
+	}
+	b.WriteString("__axion_rc=$?\n")
+	b.WriteString("(exit $__axion_rc); " + suffix + "\n")
+	b.WriteString("exit $__axion_rc")
+	return b.String()
+}
+
+// trimSeparators removes surrounding whitespace and ';' so "date;" and
+// "; echo done" can be joined with newlines
+func trimSeparators(s string) string {
+	return strings.Trim(s, " \t\r\n;")
+}
+
+// withLimits prefixes command with "umask" and "ulimit -n" settings. Empty
+// values are left alone; the command is aborted if a limit can't be applied
+func withLimits(command, umask, ulimit string) (string, error) {
+	var prefix strings.Builder
+
+	if umask != "" {
+		if !umaskRe.MatchString(umask) {
+			return "", fmt.Errorf("invalid umask '%s': expected octal like 022", umask)
+		}
+		prefix.WriteString("umask " + umask + " || exit 1\n")
+	}
+
+	if ulimit != "" {
+		if ulimit != "unlimited" {
+			n, err := strconv.Atoi(ulimit)
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("invalid ulimit '%s': expected a positive number or 'unlimited'", ulimit)
+			}
+		}
+		prefix.WriteString("ulimit -n " + ulimit + " || exit 1\n")
+	}
+
+	return prefix.String() + command, nil
+}